@@ -24,8 +24,12 @@ func main() {
 		src.RunImportInitialStockCmd(os.Args[2:])
 	case "invoice":
 		src.RunImportSalesInvoiceCmd(os.Args[2:])
+	case "invoice-item":
+		src.RunImportSalesInvoiceItemCmd(os.Args[2:])
 	case "invoice-product":
 		src.RunImportSalesInvoiceProductCmd(os.Args[2:])
+	case "invoice-reconcile":
+		src.RunInvoiceReconcileCmd(os.Args[2:])
 	case "invoice-fee":
 		src.RunImportSalesInvoiceFeeCmd(os.Args[2:])
 	case "invoice-return":
@@ -38,14 +42,22 @@ func main() {
 		src.RunImportSalesInvoiceProductOutstandingCmd(os.Args[2:])
 	case "deposit":
 		src.RunImportDepositCmd(os.Args[2:])
+	case "deposit-apply":
+		src.RunDepositApplyCmd(os.Args[2:])
 	case "giro":
 		src.RunImportGiroCmd(os.Args[2:])
+	case "giro-status":
+		src.RunGiroStatusCmd(os.Args[2:])
 	case "settlement":
 		src.RunImportSettlementCmd(os.Args[2:])
+	case "settlement-reverse":
+		src.RunSettlementReverseCmd(os.Args[2:])
 	case "intransit":
 		src.RunImportSKBCentralIntransitCmd(os.Args[2:])
 	case "intransit-product":
 		src.RunImportSKBCentralIntransitProductCmd(os.Args[2:])
+	case "intransit-receive":
+		src.RunImportSKBIntransitReceiveCmd(os.Args[2:])
 	case "invoice-product-missing":
 		src.RunImportSalesInvoiceProductMissingCmd(os.Args[2:])
 	case "transfer":
@@ -0,0 +1,5 @@
+-- settlement: the DTH number of the legacy file, kept next to the number the
+-- importer allocates in the app format; settlement-reverse --dth searches both
+ALTER TABLE list_debt_collection
+	ADD COLUMN reference_number VARCHAR(100) NULL AFTER debt_collection_number,
+	ADD INDEX idx_debt_collection_reference_number (reference_number);
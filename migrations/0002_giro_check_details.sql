@@ -0,0 +1,9 @@
+-- giro and giro-status: bank details of the giro, and the date, note and
+-- replacement number of its last status change
+ALTER TABLE list_giro_check
+	ADD COLUMN bank_name VARCHAR(100) NULL,
+	ADD COLUMN account_number VARCHAR(50) NULL,
+	ADD COLUMN receive_date DATE NULL,
+	ADD COLUMN replacement_giro_number VARCHAR(100) NULL,
+	ADD COLUMN status_date DATE NULL,
+	ADD COLUMN status_note VARCHAR(255) NULL;
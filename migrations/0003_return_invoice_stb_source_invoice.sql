@@ -0,0 +1,5 @@
+-- invoice-return-product: the sales invoice a returned line came from, used
+-- to price the return and to cap the returned qty per invoice line
+ALTER TABLE rel_return_invoice_stb
+	ADD COLUMN source_sales_invoice_id BIGINT NULL,
+	ADD INDEX idx_return_invoice_stb_source_invoice (source_sales_invoice_id, product_id);
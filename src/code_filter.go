@@ -0,0 +1,129 @@
+package src
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// codeFilter limits an import to, or away from, a set of natural keys
+// (outlet_code, product_code, invoice number) given by --only-codes and
+// --exclude-codes.
+type codeFilter struct {
+	only    map[string]bool
+	exclude map[string]bool
+}
+
+// loadCodeList reads codes from a comma separated list, or from a file when
+// value is the path of an existing file (one code per line, commas allowed).
+func loadCodeList(value string) (map[string]bool, error) {
+	items, err := readListValue(value)
+	if err != nil || items == nil {
+		return nil, err
+	}
+	codes := map[string]bool{}
+	for _, c := range items {
+		codes[c] = true
+	}
+	return codes, nil
+}
+
+// loadKeyValueList reads "key=value" pairs the same way as loadCodeList.
+func loadKeyValueList(value string) (map[string]string, error) {
+	items, err := readListValue(value)
+	if err != nil {
+		return nil, err
+	}
+	pairs := map[string]string{}
+	for _, item := range items {
+		k, v, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid pair %q, expected key=value", item)
+		}
+		pairs[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return pairs, nil
+}
+
+// readListValue splits a comma list, or the content of the file it names,
+// into trimmed non-empty items. An empty value gives nil. A single value that
+// looks like a path but is not a file is an error, so a mistyped file name
+// does not silently become a one-code list.
+func readListValue(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	raw := value
+	if st, err := os.Stat(value); err == nil && !st.IsDir() {
+		b, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		raw = string(b)
+	} else if looksLikePath(value) {
+		return nil, fmt.Errorf("list file not found: %s", value)
+	}
+	items := []string{}
+	for _, line := range strings.Split(raw, "\n") {
+		for _, c := range strings.Split(line, ",") {
+			c = strings.TrimSpace(c)
+			if c != "" {
+				items = append(items, c)
+			}
+		}
+	}
+	return items, nil
+}
+
+// looksLikePath tells a file name from a code. Codes such as invoice numbers
+// contain '/', so only explicit relative/absolute prefixes and a file
+// extension count; a comma list is never a path.
+func looksLikePath(value string) bool {
+	if strings.Contains(value, ",") {
+		return false
+	}
+	for _, prefix := range []string{"./", "../", "/", "~/", ".\\", "..\\"} {
+		if strings.HasPrefix(value, prefix) {
+			return true
+		}
+	}
+	if filepath.VolumeName(value) != "" {
+		return true
+	}
+	ext := strings.TrimPrefix(filepath.Ext(value), ".")
+	if ext == "" || len(ext) > 4 {
+		return false
+	}
+	for _, r := range ext {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func newCodeFilter(only, exclude string) (*codeFilter, error) {
+	o, err := loadCodeList(only)
+	if err != nil {
+		return nil, err
+	}
+	e, err := loadCodeList(exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &codeFilter{only: o, exclude: e}, nil
+}
+
+// allows reports whether a row with this code should be imported.
+func (c *codeFilter) allows(code string) bool {
+	if c == nil {
+		return true
+	}
+	code = strings.TrimSpace(code)
+	if c.only != nil && !c.only[code] {
+		return false
+	}
+	return !c.exclude[code]
+}
@@ -0,0 +1,209 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// list_sales_invoice.track_status_id values
+const (
+	TrackStatusNone        = 0
+	TrackStatusScheduled   = 1 // dijadwalkan / diserahkan ke piutang
+	TrackStatusInTransit   = 2 // dalam perjalanan
+	TrackStatusReceived    = 3 // diterima / diterima oleh piutang
+	TrackStatusCancelled   = 4 // dibatalkan transaksinya
+	TrackStatusRescheduled = 5 // penjadwalan ulang
+)
+
+// list_sales_invoice.track_position_id values
+const (
+	TrackPositionNone      = 0
+	TrackPositionWarehouse = 1 // gudang
+	TrackPositionLoper     = 2 // loper
+	TrackPositionPiutang   = 3 // piutang
+	TrackPositionOutlet    = 4 // outlet
+)
+
+var trackStatusNames = map[int]string{
+	TrackStatusNone:        "belum ada",
+	TrackStatusScheduled:   "dijadwalkan",
+	TrackStatusInTransit:   "dalam perjalanan",
+	TrackStatusReceived:    "diterima",
+	TrackStatusCancelled:   "dibatalkan transaksinya",
+	TrackStatusRescheduled: "penjadwalan ulang",
+}
+
+// trackTransitions lists the statuses an invoice may move to. A received
+// invoice starts the next stage (faktur kembali, ke piutang) as scheduled;
+// a cancelled one is final. An invoice without tracking may start anywhere,
+// since legacy files often begin halfway through.
+var trackTransitions = map[int][]int{
+	TrackStatusScheduled:   {TrackStatusInTransit, TrackStatusReceived, TrackStatusCancelled, TrackStatusRescheduled},
+	TrackStatusInTransit:   {TrackStatusReceived, TrackStatusCancelled, TrackStatusRescheduled},
+	TrackStatusReceived:    {TrackStatusScheduled, TrackStatusReceived},
+	TrackStatusRescheduled: {TrackStatusScheduled, TrackStatusInTransit, TrackStatusCancelled},
+}
+
+// parseTrackStatus maps the status text. Statuses that name the piutang
+// desk also fix the position.
+func parseTrackStatus(v *string) (status, impliedPosition int, err error) {
+	if v == nil {
+		return 0, 0, fmt.Errorf("status track kosong")
+	}
+	switch strings.ToLower(strings.TrimSpace(*v)) {
+	case "dijadwalkan":
+		return TrackStatusScheduled, TrackPositionNone, nil
+	case "diserahkan ke piutang":
+		return TrackStatusScheduled, TrackPositionPiutang, nil
+	case "dalam perjalanan":
+		return TrackStatusInTransit, TrackPositionLoper, nil
+	case "diterima":
+		return TrackStatusReceived, TrackPositionNone, nil
+	case "diterima oleh piutang":
+		return TrackStatusReceived, TrackPositionPiutang, nil
+	case "dibatalkan transaksinya":
+		return TrackStatusCancelled, TrackPositionNone, nil
+	case "penjadwalan ulang":
+		return TrackStatusRescheduled, TrackPositionNone, nil
+	}
+	return 0, 0, fmt.Errorf("status track tidak dikenal: %s", *v)
+}
+
+func parseTrackPosition(v *string) (int, error) {
+	if v == nil {
+		return TrackPositionNone, nil
+	}
+	switch strings.ToLower(strings.TrimSpace(*v)) {
+	case "gudang":
+		return TrackPositionWarehouse, nil
+	case "loper":
+		return TrackPositionLoper, nil
+	case "piutang":
+		return TrackPositionPiutang, nil
+	case "outlet":
+		return TrackPositionOutlet, nil
+	}
+	return 0, fmt.Errorf("posisi faktur tidak dikenal: %s", *v)
+}
+
+// resolveTrackPosition checks the position against the one implied by the
+// status and fills it in when the cell is empty.
+func resolveTrackPosition(position, impliedPosition int) (int, error) {
+	if impliedPosition == TrackPositionNone {
+		if position == TrackPositionNone {
+			return 0, fmt.Errorf("posisi faktur kosong")
+		}
+		return position, nil
+	}
+	if position != TrackPositionNone && position != impliedPosition {
+		return 0, fmt.Errorf("posisi faktur tidak sesuai dengan status")
+	}
+	return impliedPosition, nil
+}
+
+func trackStatusName(status int) string {
+	if name, ok := trackStatusNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("status %d", status)
+}
+
+// checkTrackTransition validates moving an invoice from its current state
+// to the given status, position and date.
+func checkTrackTransition(current *InvoiceTrackState, status, position int, date string) error {
+	if current.Date != "" && date < current.Date {
+		return fmt.Errorf("tanggal %s lebih awal dari track terakhir %s", date, current.Date)
+	}
+	if current.Status == TrackStatusNone {
+		return nil
+	}
+	for _, s := range trackTransitions[current.Status] {
+		if s != status {
+			continue
+		}
+		if s == current.Status && position == current.Position {
+			break
+		}
+		return nil
+	}
+	return fmt.Errorf("perubahan status dari %s ke %s tidak diizinkan", trackStatusName(current.Status), trackStatusName(status))
+}
+
+// loadInvoiceTrackState reads the tracking state an invoice has in the DB.
+func loadInvoiceTrackState(tx *sql.Tx, salesInvoiceID int64) (*InvoiceTrackState, error) {
+	st := &InvoiceTrackState{}
+	var status, position sql.NullInt64
+	var lastDate sql.NullTime
+	err := tx.QueryRow(`
+		SELECT i.track_status_id, i.track_position_id,
+			(SELECT MAX(r.date_track) FROM rel_track_history_invoice r WHERE r.sales_invoice_id = i.sales_invoice_id)
+		FROM list_sales_invoice i
+		WHERE i.sales_invoice_id = ?
+	`, salesInvoiceID).Scan(&status, &position, &lastDate)
+	if err != nil {
+		return nil, err
+	}
+	st.Status = int(status.Int64)
+	st.Position = int(position.Int64)
+	if lastDate.Valid {
+		st.Date = lastDate.Time.Format("2006-01-02")
+	}
+	return st, nil
+}
+
+// readDMFRows reads the data rows of one or more DMF files and orders them
+// by DMF date, so files covering different periods can be imported in one
+// run regardless of the order they are given in.
+func readDMFRows(paths []string, sheetName string) ([]DMFRow, error) {
+	out := []DMFRow{}
+	for _, path := range paths {
+		f, err := excelize.OpenFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		sheet := sheetName
+		if sheet == "" {
+			sheet = f.GetSheetName(0)
+		}
+		rows, err := f.GetRows(sheet)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for r := 1; r < len(rows); r++ { // skip header row
+			cols := rows[r]
+			if len(cols) < 2 || checkIsTrueEmpty(cols[0]) == nil {
+				continue
+			}
+			if checkIsTrueEmpty(cols[1]) == nil {
+				break // no dmf type, end of data
+			}
+			row := DMFRow{File: path, Row: r + 1, Cols: cols}
+			if d, ok := parseDateStrict(checkIsTrueEmpty(cols[0])); ok && d != nil {
+				row.Date = d.(string)
+			}
+			out = append(out, row)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+	return out, nil
+}
+
+// Helper structs
+type InvoiceTrackState struct {
+	Status   int
+	Position int
+	Date     string
+	Group    string
+}
+
+type DMFRow struct {
+	File string
+	Row  int
+	Date string
+	Cols []string
+}
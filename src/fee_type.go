@@ -0,0 +1,83 @@
+package src
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// defaultFeeAliases maps legacy fee names to list_fee_type names.
+var defaultFeeAliases = map[string]string{
+	"ongkir":      "Ongkos Kirim",
+	"biaya kirim": "Ongkos Kirim",
+	"meterai":     "Materai",
+	"bea materai": "Materai",
+	"bea meterai": "Materai",
+}
+
+// feeTypeResolver resolves fee names against list_fee_type, following
+// aliases and optionally creating missing fee types.
+type feeTypeResolver struct {
+	tx      *sql.Tx
+	byName  map[string]int64
+	aliases map[string]string
+	create  bool
+	adminID int
+}
+
+func newFeeTypeResolver(tx *sql.Tx, aliases map[string]string, create bool, adminID int) (*feeTypeResolver, error) {
+	r := &feeTypeResolver{
+		tx:      tx,
+		byName:  make(map[string]int64),
+		aliases: make(map[string]string),
+		create:  create,
+		adminID: adminID,
+	}
+	for k, v := range defaultFeeAliases {
+		r.aliases[k] = v
+	}
+	for k, v := range aliases {
+		r.aliases[normalizeFeeName(k)] = v
+	}
+
+	rows, err := tx.Query("SELECT fee_type_id, fee_type_name FROM list_fee_type")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		r.byName[normalizeFeeName(name)] = id
+	}
+	return r, rows.Err()
+}
+
+func normalizeFeeName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// resolve returns the fee type id for a name, 0 when it is unknown and may
+// not be created. created is true when the fee type was inserted.
+func (r *feeTypeResolver) resolve(name string) (id int64, created bool, err error) {
+	key := normalizeFeeName(name)
+	if alias, ok := r.aliases[key]; ok {
+		name = alias
+		key = normalizeFeeName(alias)
+	}
+	if id, ok := r.byName[key]; ok {
+		return id, false, nil
+	}
+	if !r.create || key == "" {
+		return 0, false, nil
+	}
+	res, err := r.tx.Exec("INSERT INTO list_fee_type (fee_type_name, createdAt, createdBy) VALUES (?, NOW(), ?)", strings.TrimSpace(name), r.adminID)
+	if err != nil {
+		return 0, false, err
+	}
+	id, _ = res.LastInsertId()
+	r.byName[key] = id
+	return id, true, nil
+}
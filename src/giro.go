@@ -0,0 +1,148 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// list_giro_check.status_id values
+const (
+	GiroStatusPending   = 1 // belum cair
+	GiroStatusCleared   = 2 // cair
+	GiroStatusBounced   = 3 // tolak
+	GiroStatusCancelled = 4 // batal
+	GiroStatusReplaced  = 5 // diganti giro lain
+)
+
+// giroDetailColumns are the list_giro_check columns added by
+// migrations/0002_giro_check_details.sql.
+var giroDetailColumns = []string{"bank_name", "account_number", "receive_date", "replacement_giro_number", "status_date", "status_note"}
+
+// list_settlement.settlement_status_id for a giro settlement that waits for
+// the giro to clear.
+const SettlementStatusPending = 1
+
+var giroStatusNames = map[int]string{
+	GiroStatusPending:   "belum cair",
+	GiroStatusCleared:   "cair",
+	GiroStatusBounced:   "tolak",
+	GiroStatusCancelled: "batal",
+	GiroStatusReplaced:  "ganti",
+}
+
+// giroTransitions lists the statuses a giro may move to. Cleared, cancelled
+// and replaced giros are final; a bounced giro can still be replaced.
+var giroTransitions = map[int][]int{
+	GiroStatusPending: {GiroStatusCleared, GiroStatusBounced, GiroStatusCancelled, GiroStatusReplaced},
+	GiroStatusBounced: {GiroStatusReplaced},
+}
+
+// parseGiroStatus maps the legacy status text. An empty cell means cair,
+// like the old importer did.
+func parseGiroStatus(v *string) (int, error) {
+	if v == nil {
+		return GiroStatusCleared, nil
+	}
+	s := strings.ToLower(strings.TrimSpace(*v))
+	switch {
+	case strings.Contains(s, "belum"):
+		return GiroStatusPending, nil
+	case strings.Contains(s, "tolak"), strings.Contains(s, "bounce"):
+		return GiroStatusBounced, nil
+	case strings.Contains(s, "batal"), strings.Contains(s, "cancel"):
+		return GiroStatusCancelled, nil
+	case strings.Contains(s, "ganti"), strings.Contains(s, "replace"):
+		return GiroStatusReplaced, nil
+	case strings.Contains(s, "cair"), strings.Contains(s, "clear"):
+		return GiroStatusCleared, nil
+	}
+	return 0, fmt.Errorf("status giro tidak dikenal: %s", *v)
+}
+
+func giroStatusName(statusID int) string {
+	if name, ok := giroStatusNames[statusID]; ok {
+		return name
+	}
+	return fmt.Sprintf("status %d", statusID)
+}
+
+func canTransitionGiro(from, to int) bool {
+	for _, s := range giroTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// settlementStatusForGiro gives the status of a settlement paid with a giro:
+// approved once the giro cleared, pending while it is still open.
+func settlementStatusForGiro(giroStatusID int) int {
+	if giroStatusID == GiroStatusCleared {
+		return SettlementStatusApproved
+	}
+	return SettlementStatusPending
+}
+
+// transitionGiro moves a giro to a new status and applies the effect on its
+// settlement: clearing approves it, bouncing, cancelling or replacing the
+// giro reverses the settlement chain so the invoices are open again.
+func transitionGiro(tx *sql.Tx, giro *GiroStatusData, toStatus int, statusDate interface{}, replacement, note string, report *importReport) error {
+	if giro.StatusID == toStatus {
+		return nil
+	}
+	if !canTransitionGiro(giro.StatusID, toStatus) {
+		return fmt.Errorf("giro %s tidak bisa diubah dari %s ke %s", giro.GiroNumber, giroStatusName(giro.StatusID), giroStatusName(toStatus))
+	}
+
+	var replacementVal, noteVal interface{}
+	if replacement != "" {
+		replacementVal = replacement
+	}
+	if note != "" {
+		noteVal = note
+	}
+	_, err := tx.Exec(`
+		UPDATE list_giro_check
+		SET status_id = ?, status_date = ?, replacement_giro_number = COALESCE(?, replacement_giro_number),
+			status_note = ?
+		WHERE giro_id = ?
+	`, toStatus, statusDate, replacementVal, noteVal, giro.GiroID)
+	if err != nil {
+		return err
+	}
+
+	if !giro.SettlementID.Valid {
+		return nil
+	}
+	if toStatus == GiroStatusCleared {
+		_, err = tx.Exec("UPDATE list_settlement SET settlement_status_id = ? WHERE settlement_id = ? AND settlement_status_id = ?",
+			SettlementStatusApproved, giro.SettlementID.Int64, SettlementStatusPending)
+		return err
+	}
+
+	var dthID int64
+	var dthNumber string
+	err = tx.QueryRow(`
+		SELECT ldc.debt_collection_id, ldc.debt_collection_number
+		FROM list_settlement ls
+		JOIN list_debt_collection ldc ON ldc.debt_collection_id = ls.debt_collection_id
+		WHERE ls.settlement_id = ?
+	`, giro.SettlementID.Int64).Scan(&dthID, &dthNumber)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	_, err = reverseSettlementChain(tx, dthID, dthNumber, report)
+	return err
+}
+
+// Helper struct
+type GiroStatusData struct {
+	GiroID       int64
+	GiroNumber   string
+	StatusID     int
+	SettlementID sql.NullInt64
+}
@@ -61,6 +61,13 @@ func checkImportColumn(tx *sql.Tx, fieldName, tableName, value string, options m
 		value = ""
 	}
 
+	// towns are matched by normalised name, a LIKE match could pick Kota
+	// instead of Kabupaten; an ambiguous name gives NULL
+	if tableName == "list_town" {
+		id, _, err := findTownID(tx, value)
+		return id, err
+	}
+
 	// search existing row by LIKE
 	searchQ := fmt.Sprintf("SELECT * FROM `%s` WHERE `%s` LIKE ? ORDER BY 1 ASC LIMIT 1;", tableName, fieldName)
 	likeVal := "%" + value + "%"
@@ -129,7 +136,7 @@ func checkImportColumn(tx *sql.Tx, fieldName, tableName, value string, options m
 		return sql.NullInt64{Int64: id, Valid: true}, nil
 
 	case "list_town":
-		// PHP returns null
+		// PHP returns null; towns are never created from an import
 		return sql.NullInt64{Valid: false}, nil
 
 	case "list_principal_division":
@@ -204,6 +211,46 @@ func checkImportColumn(tx *sql.Tx, fieldName, tableName, value string, options m
 	}
 }
 
+// nullIfEmpty binds an empty string as NULL.
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// requireColumns fails when table lacks one of columns, naming the file in
+// migrations/ that adds them, so an import stops before writing instead of
+// failing halfway on an unknown column.
+func requireColumns(tx *sql.Tx, table, migration string, columns ...string) error {
+	rows, err := tx.Query("SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	present := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		present[strings.ToLower(name)] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	missing := []string{}
+	for _, c := range columns {
+		if !present[strings.ToLower(c)] {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s has no column %s, apply migrations/%s first", table, strings.Join(missing, ", "), migration)
+	}
+	return nil
+}
+
 func updateActivity(tx *sql.Tx, logID interface{}, label string, link interface{}, metaData interface{}) error {
 	// Only update when logID is not false / not nil
 	if logID == nil {
@@ -251,18 +298,31 @@ func getProductGroupByName(tx *sql.Tx, name string) (*sql.Row, error) {
 }
 
 func parseDateForSQL(cell *string) interface{} {
-	if cell == nil {
+	d, ok := parseDateStrict(cell)
+	if !ok {
+		// Tidak dikenali: log peringatan dan masukkan NULL agar tidak error DB
+		log.Printf("warning: cannot parse date '%s', will insert NULL\n", strings.TrimSpace(*cell))
 		return nil
 	}
+	return d
+}
+
+// parseDateStrict parses a date cell to YYYY-MM-DD. An empty cell gives
+// (nil, true); a cell that is filled but not a recognisable date gives
+// (nil, false) so callers can tell garbage apart from "no date".
+func parseDateStrict(cell *string) (interface{}, bool) {
+	if cell == nil {
+		return nil, true
+	}
 	s := strings.TrimSpace(*cell)
 	if s == "" {
-		return nil
+		return nil, true
 	}
 
 	// 1) coba parse sebagai Excel serial (angka)
 	if f, err := strconv.ParseFloat(s, 64); err == nil {
 		if t, err2 := excelize.ExcelDateToTime(f, false); err2 == nil {
-			return t.Format("2006-01-02")
+			return t.Format("2006-01-02"), true
 		}
 	}
 
@@ -278,7 +338,7 @@ func parseDateForSQL(cell *string) interface{} {
 	}
 	for _, layout := range layouts {
 		if t, err := time.Parse(layout, s); err == nil {
-			return t.Format("2006-01-02")
+			return t.Format("2006-01-02"), true
 		}
 	}
 
@@ -305,14 +365,12 @@ func parseDateForSQL(cell *string) interface{} {
 			yi, err3 := strconv.Atoi(y)
 			if err1 == nil && err2 == nil && err3 == nil {
 				t := time.Date(yi, time.Month(mi), di, 0, 0, 0, 0, time.UTC)
-				return t.Format("2006-01-02")
+				return t.Format("2006-01-02"), true
 			}
 		}
 	}
 
-	// Tidak dikenali: log peringatan dan masukkan NULL agar tidak error DB
-	log.Printf("warning: cannot parse date '%s', will insert NULL\n", s)
-	return nil
+	return nil, false
 }
 
 func denormInt(p *string) int64 {
@@ -363,13 +421,23 @@ func denormFloat(val *string) float64 {
 		return 0
 	}
 
-	s := strings.TrimSpace(*val)
+	s := normalizeDecimal(*val)
 	if s == "" {
 		return 0
 	}
 
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// normalizeDecimal turns a number cell into plain decimal notation
+// ("1.234,56" -> "1234.56"), the form denormFloat and denormMoney parse.
+func normalizeDecimal(v string) string {
 	// Hapus semua spasi
-	s = strings.ReplaceAll(s, " ", "")
+	s := strings.ReplaceAll(strings.TrimSpace(v), " ", "")
 
 	// Normalisasi angka dengan koma (contoh: "1.234,56" -> "1234.56")
 	// deteksi format Eropa (koma sebagai decimal)
@@ -386,12 +454,7 @@ func denormFloat(val *string) float64 {
 		// anggap koma adalah desimal
 		s = strings.ReplaceAll(s, ",", ".")
 	}
-
-	f, err := strconv.ParseFloat(s, 64)
-	if err != nil {
-		return 0
-	}
-	return f
+	return s
 }
 
 func containsInt64(slice []int64, val int64) bool {
@@ -402,3 +465,29 @@ func containsInt64(slice []int64, val int64) bool {
 	}
 	return false
 }
+
+// getOrInsertProductBatch returns the batch_id for product+batch+expiry,
+// inserting a new list_product_batch row when none exists yet.
+func getOrInsertProductBatch(tx *sql.Tx, cache map[string]int64, productID int64, batchNumber string, expiredDate interface{}, adminID int) (int64, error) {
+	key := fmt.Sprintf("%d|%s|%v", productID, batchNumber, expiredDate)
+	if id, ok := cache[key]; ok {
+		return id, nil
+	}
+
+	var batchID int64
+	err := tx.QueryRow("SELECT batch_id FROM list_product_batch WHERE product_id = ? AND batch_number = ? AND expired_date <=> ? LIMIT 1",
+		productID, batchNumber, expiredDate).Scan(&batchID)
+	if err == sql.ErrNoRows {
+		res, errIns := tx.Exec("INSERT INTO list_product_batch (product_id, batch_number, expired_date, createdAt, createdBy) VALUES (?, ?, ?, NOW(), ?)",
+			productID, batchNumber, expiredDate, adminID)
+		if errIns != nil {
+			return 0, errIns
+		}
+		batchID, _ = res.LastInsertId()
+	} else if err != nil {
+		return 0, err
+	}
+
+	cache[key] = batchID
+	return batchID, nil
+}
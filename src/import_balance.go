@@ -20,6 +20,10 @@ func RunImportBeginningBalanceCmd(args []string) {
 	adminID := fs.Int("admin-id", 1, "createdBy admin id")
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	controlSheet := fs.String("control-sheet", BalanceControlSheet, "sheet with expected totals per branch and account type (skipped when absent)")
+	tolerance := fs.String("tolerance", "1", "allowed difference between imported and expected totals")
+	missingBankAccount := fs.String("missing-bank-account", MissingBankAccountReject, "bank account not in list_bank_account: reject|create")
+	reportPath := fs.String("report", "", "path to xlsx report of skipped rows and control totals (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
@@ -31,6 +35,19 @@ func RunImportBeginningBalanceCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	toleranceAmount, err := parseMoneyFlag("tolerance", *tolerance)
+	if err != nil {
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if *missingBankAccount != MissingBankAccountReject && *missingBankAccount != MissingBankAccountCreate {
+		resp.Message = "invalid missing-bank-account policy: " + *missingBankAccount
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
 		out, _ := json.Marshal(resp)
@@ -66,6 +83,42 @@ func RunImportBeginningBalanceCmd(args []string) {
 		os.Exit(1)
 	}
 
+	// Expected totals: 0 branch_code, 1 account_type_name, 2 total
+	var controlTotals map[string]Money
+	controlOrder := []string{}
+	if idx, _ := f.GetSheetIndex(*controlSheet); idx >= 0 && *controlSheet != sheet {
+		controlRows, err := f.GetRows(*controlSheet)
+		if err != nil {
+			resp.Message = "error reading control sheet rows: " + err.Error()
+			out, _ := json.Marshal(resp)
+			fmt.Println(string(out))
+			os.Exit(1)
+		}
+		controlTotals = make(map[string]Money)
+		for r := 1; r < len(controlRows); r++ {
+			branchCode := ""
+			accountTypeName := ""
+			var totalPtr *string
+			if len(controlRows[r]) > 0 {
+				branchCode = strings.TrimSpace(controlRows[r][0])
+			}
+			if len(controlRows[r]) > 1 {
+				accountTypeName = normalizeAccountTypeName(controlRows[r][1])
+			}
+			if len(controlRows[r]) > 2 {
+				totalPtr = checkIsTrueEmpty(controlRows[r][2])
+			}
+			if branchCode == "" || accountTypeName == "" {
+				continue
+			}
+			key := balanceControlKey(branchCode, accountTypeName)
+			if _, ok := controlTotals[key]; !ok {
+				controlOrder = append(controlOrder, key)
+			}
+			controlTotals[key] += denormMoney(totalPtr)
+		}
+	}
+
 	db, err := sql.Open("mysql", *dsn)
 	if err != nil {
 		resp.Message = "db open error: " + err.Error()
@@ -89,6 +142,13 @@ func RunImportBeginningBalanceCmd(args []string) {
 	accountTypeCache := make(map[string]int64)
 	bankAccountCache := make(map[string]int64)
 
+	skippedReport := newImportReport("Dilewati", "Baris", "Kode Cabang", "Tipe Akun", "No Rekening", "Keterangan")
+	controlReport := newImportReport("Kontrol Saldo", "Kode Cabang", "Tipe Akun", "Total Import", "Total Kontrol", "Selisih", "Keterangan")
+	importedTotals := make(map[string]Money)
+	importedOrder := []string{}
+	openingSeen := make(map[string]int)
+	mismatchCount := 0
+
 	// Batch containers
 	cols := []string{
 		"ledger_date", "ledger_number", "branch_id", "principal_id",
@@ -113,7 +173,7 @@ func RunImportBeginningBalanceCmd(args []string) {
 
 		// Minimum columns check
 		// indices: 0 ledger_date, 1 branch_code, 2 principal_code, 3 account_type_name,
-		//          4 bank_account_number, 5 balance, 6 ledger_note
+		//          4 bank_account_number, 5 balance, 6 ledger_note, 7 bank name (for --missing-bank-account=create)
 		if len(rowData) < 6 {
 			fmt.Println("colum lebih kecil dari 6")
 			continue
@@ -142,12 +202,12 @@ func RunImportBeginningBalanceCmd(args []string) {
 
 		// Parse ledger date
 		ledgerDate := parseDateForSQL(ledgerDatePtr)
-		if ledgerDate == "" {
+		if ledgerDate == nil {
 			ledgerDate = time.Now().Format("2006-01-02")
 		}
 
 		// Generate ledger number (simplified - should use proper generator)
-		ledgerNumber := fmt.Sprintf("LEDGER-%d-%d", time.Now().Unix(), groupIndex)
+		ledgerNumber := fmt.Sprintf("%s%d-%d", OpeningLedgerPrefix, time.Now().Unix(), groupIndex)
 
 		branchCode := strings.TrimSpace(*branchCodePtr)
 
@@ -155,7 +215,7 @@ func RunImportBeginningBalanceCmd(args []string) {
 		if principalCodePtr != nil {
 			principalCode = strings.TrimSpace(*principalCodePtr)
 		}
-		accountTypeName := strings.TrimSpace(*accountTypeNamePtr)
+		accountTypeName := normalizeAccountTypeName(*accountTypeNamePtr)
 		bankAccountNumber := ""
 		if bankAccountNumberPtr != nil {
 			bankAccountNumber = strings.TrimSpace(*bankAccountNumberPtr)
@@ -175,6 +235,7 @@ func RunImportBeginningBalanceCmd(args []string) {
 
 			if err == sql.ErrNoRows {
 				fmt.Printf("Branch not found: %s\n", branchCode)
+				skippedReport.add(r+1, branchCode, accountTypeName, bankAccountNumber, "cabang tidak ditemukan")
 				continue
 			} else if err != nil {
 				_ = tx.Rollback()
@@ -218,12 +279,6 @@ func RunImportBeginningBalanceCmd(args []string) {
 		}
 
 		// Get or cache account type
-		if accountTypeName == "Bank Kas Besar" {
-			accountTypeName = "Bank Besar"
-		}
-		if accountTypeName == "Bank Kas Kecil" {
-			accountTypeName = "Bank Kecil"
-		}
 		var accountTypeID int64
 		if cached, ok := accountTypeCache[accountTypeName]; ok {
 			accountTypeID = cached
@@ -237,6 +292,7 @@ func RunImportBeginningBalanceCmd(args []string) {
 
 			if err == sql.ErrNoRows {
 				fmt.Printf("Account type not found: %s\n", accountTypeName)
+				skippedReport.add(r+1, branchCode, accountTypeName, bankAccountNumber, "tipe akun tidak ditemukan")
 				continue
 			} else if err != nil {
 				_ = tx.Rollback()
@@ -260,8 +316,19 @@ func RunImportBeginningBalanceCmd(args []string) {
 				LIMIT 1
 			`, bankAccountNumber).Scan(&bId)
 
-				if err == sql.ErrNoRows {
+				if err == sql.ErrNoRows && *missingBankAccount == MissingBankAccountCreate {
+					bId, err = createBankAccount(tx, bankAccountNumber, getString(getCol(7)), branchID, accountTypeID, *adminID)
+					if err != nil {
+						_ = tx.Rollback()
+						resp.Message = "error creating bank account: " + err.Error()
+						goto FINISH
+					}
+					skippedReport.add(r+1, branchCode, accountTypeName, bankAccountNumber, "rekening bank dibuat")
+					bankAccountID = sql.NullInt64{Int64: bId, Valid: true}
+					bankAccountCache[bankAccountNumber] = bId
+				} else if err == sql.ErrNoRows {
 					fmt.Printf("Bank account not found: %s\n", bankAccountNumber)
+					skippedReport.add(r+1, branchCode, accountTypeName, bankAccountNumber, "rekening bank tidak ditemukan")
 					continue
 				} else if err != nil {
 					_ = tx.Rollback()
@@ -274,7 +341,31 @@ func RunImportBeginningBalanceCmd(args []string) {
 			}
 		}
 
-		balance := denormFloat(balancePtr)
+		// One opening entry per branch, account type and bank account
+		openingKey := fmt.Sprintf("%d|%d|%d", branchID, accountTypeID, bankAccountID.Int64)
+		if firstRow, ok := openingSeen[openingKey]; ok {
+			skippedReport.add(r+1, branchCode, accountTypeName, bankAccountNumber, fmt.Sprintf("saldo awal ganda, sama dengan baris %d", firstRow))
+			continue
+		}
+		exists, err := openingBalanceExists(tx, branchID, accountTypeID, bankAccountID)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error checking opening balance: " + err.Error()
+			goto FINISH
+		}
+		if exists {
+			skippedReport.add(r+1, branchCode, accountTypeName, bankAccountNumber, "saldo awal sudah ada di database")
+			continue
+		}
+		openingSeen[openingKey] = r + 1
+
+		balance := denormMoney(balancePtr)
+
+		controlKey := balanceControlKey(branchCode, accountTypeName)
+		if _, ok := importedTotals[controlKey]; !ok {
+			importedOrder = append(importedOrder, controlKey)
+		}
+		importedTotals[controlKey] += balance
 
 		ledgerNote := ""
 		if ledgerNotePtr != nil {
@@ -327,6 +418,41 @@ func RunImportBeginningBalanceCmd(args []string) {
 		insertedCount += len(batchRows)
 	}
 
+	// Verify against the control sheet
+	if controlTotals != nil {
+		for _, key := range importedOrder {
+			branchCode, accountTypeName, _ := strings.Cut(key, "|")
+			expected, ok := controlTotals[key]
+			if !ok {
+				controlReport.add(branchCode, accountTypeName, importedTotals[key], nil, nil, "tidak ada di sheet kontrol")
+				mismatchCount++
+				continue
+			}
+			diff := importedTotals[key] - expected
+			if diff.abs() > toleranceAmount {
+				controlReport.add(branchCode, accountTypeName, importedTotals[key], expected, diff, "tidak sesuai")
+				mismatchCount++
+			} else {
+				controlReport.add(branchCode, accountTypeName, importedTotals[key], expected, diff, "sesuai")
+			}
+		}
+		for _, key := range controlOrder {
+			if _, ok := importedTotals[key]; !ok {
+				branchCode, accountTypeName, _ := strings.Cut(key, "|")
+				controlReport.add(branchCode, accountTypeName, 0, controlTotals[key], -controlTotals[key], "tidak ada di data import")
+				mismatchCount++
+			}
+		}
+	}
+	if mismatchCount > 0 {
+		_ = tx.Rollback()
+		if err := writeReports(*reportPath, controlReport, skippedReport); err != nil {
+			log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+		}
+		resp.Message = fmt.Sprintf("saldo tidak sesuai sheet kontrol: %d selisih, import dibatalkan", mismatchCount)
+		goto FINISH
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
@@ -334,12 +460,77 @@ func RunImportBeginningBalanceCmd(args []string) {
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, controlReport, skippedReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import Beginning Balance Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d ledger entries inserted. Execution Time: %.4fs", insertedCount, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d ledger entries inserted, %d rows skipped. Execution Time: %.4fs", insertedCount, skippedReport.count(), time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
 	fmt.Println(string(out))
 	log.Printf("import beginning balance complete: %d entries, time=%.4fs\n", insertedCount, time.Since(start).Seconds())
 }
+
+// Default name of the sheet holding expected totals per branch and account type.
+const BalanceControlSheet = "Kontrol"
+
+// Policies for a bank account number that is not in list_bank_account.
+const (
+	MissingBankAccountReject = "reject"
+	MissingBankAccountCreate = "create"
+)
+
+// Prefix of ledger numbers written by this importer; it marks opening entries.
+const OpeningLedgerPrefix = "LEDGER-"
+
+// accountTypeAliases maps legacy account type names to list_account_type.
+var accountTypeAliases = map[string]string{
+	"bank kas besar": "Bank Besar",
+	"bank kas kecil": "Bank Kecil",
+}
+
+func normalizeAccountTypeName(name string) string {
+	name = strings.TrimSpace(name)
+	if alias, ok := accountTypeAliases[strings.ToLower(name)]; ok {
+		return alias
+	}
+	return name
+}
+
+func balanceControlKey(branchCode, accountTypeName string) string {
+	return strings.ToUpper(strings.TrimSpace(branchCode)) + "|" + strings.ToLower(accountTypeName)
+}
+
+// openingBalanceExists reports whether an opening entry for this branch,
+// account type and bank account was imported before.
+func openingBalanceExists(tx *sql.Tx, branchID, accountTypeID int64, bankAccountID sql.NullInt64) (bool, error) {
+	var dummy int
+	err := tx.QueryRow(`
+		SELECT 1
+		FROM list_cash_ledger
+		WHERE branch_id = ? AND account_type_id = ? AND bank_account_id <=> ? AND ledger_number LIKE ?
+		LIMIT 1
+	`, branchID, accountTypeID, bankAccountID, OpeningLedgerPrefix+"%").Scan(&dummy)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// createBankAccount inserts a bank account for --missing-bank-account=create.
+func createBankAccount(tx *sql.Tx, accountNumber, bankName string, branchID, accountTypeID int64, adminID int) (int64, error) {
+	if bankName == "" {
+		bankName = accountNumber
+	}
+	res, err := tx.Exec(`
+		INSERT INTO list_bank_account (account_number, bank_name, branch_id, account_type_id, createdAt, createdBy)
+		VALUES (?, ?, ?, ?, NOW(), ?)
+	`, accountNumber, bankName, branchID, accountTypeID, adminID)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
@@ -20,6 +20,7 @@ func RunImportDepositCmd(args []string) {
 	adminID := fs.Int("admin-id", 1, "createdBy admin id")
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	reportPath := fs.String("report", "", "path to xlsx report of skipped rows and per-outlet deposit balances (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
@@ -85,8 +86,15 @@ func RunImportDepositCmd(args []string) {
 
 	// Caches
 	branchCache := make(map[string]*BranchData)
-	invoiceCache := make(map[string]*int64)
-	returnInvoiceCache := make(map[string]*int64)
+	outletCache := make(map[string]*int64)
+	invoiceCache := make(map[string]*DepositRefData)
+	returnInvoiceCache := make(map[string]*DepositRefData)
+	bookedReturns := make(map[int64]bool)
+
+	skippedReport := newImportReport("Dilewati", "Baris", "Kode Outlet", "No Deposit", "Keterangan")
+	balanceReport := newImportReport("Saldo Deposit", "Kode Outlet", "Jumlah Baris", "Saldo Sebelum", "Total Debit", "Saldo Setelah")
+	balances := make(map[string]*DepositBalanceData)
+	balanceOrder := []string{}
 
 	// Batch containers
 	cols := []string{
@@ -97,6 +105,7 @@ func RunImportDepositCmd(args []string) {
 	}
 	batchRows := [][]interface{}{}
 	insertedCount := 0
+	totalDeposit := Money(0)
 	rowIndex := 0
 
 	for r := 1; r < len(rows); r++ { // skip header row
@@ -124,7 +133,7 @@ func RunImportDepositCmd(args []string) {
 
 		depositTypePtr := getCol(1)
 		branchCodePtr := getCol(2)
-		if *branchCodePtr == "Freetext" {
+		if branchCodePtr != nil && *branchCodePtr == "Freetext" {
 			continue
 		}
 		outletCodePtr := getCol(3)
@@ -140,7 +149,7 @@ func RunImportDepositCmd(args []string) {
 
 		// Parse deposit date
 		depositDate := parseDateForSQL(datePtr)
-		if depositDate == "" {
+		if depositDate == nil {
 			depositDate = time.Now().Format("2006-01-02")
 		}
 
@@ -185,14 +194,35 @@ func RunImportDepositCmd(args []string) {
 			branchCache[branchCode] = branch
 		}
 
-		// Parse outlet code
-		outletID := int64(0)
-		if outletCodePtr != nil {
-			outletID = denormInt(outletCodePtr)
+		// Resolve outlet code
+		if outletCodePtr == nil {
+			skippedReport.add(r+1, nil, getString(depositNumberPtr), "kode outlet kosong")
+			continue
+		}
+		outletCode := strings.TrimSpace(*outletCodePtr)
+		outletIDPtr, ok := outletCache[outletCode]
+		if !ok {
+			var oid int64
+			err = tx.QueryRow("SELECT outlet_id FROM list_outlet WHERE outlet_code = ? LIMIT 1", outletCode).Scan(&oid)
+			if err == sql.ErrNoRows {
+				outletCache[outletCode] = nil
+			} else if err != nil {
+				_ = tx.Rollback()
+				resp.Message = "error querying outlet: " + err.Error()
+				goto FINISH
+			} else {
+				outletIDPtr = &oid
+				outletCache[outletCode] = outletIDPtr
+			}
 		}
+		if outletIDPtr == nil {
+			skippedReport.add(r+1, outletCode, getString(depositNumberPtr), "outlet tidak ditemukan")
+			continue
+		}
+		outletID := *outletIDPtr
 
 		// Parse debit
-		debit := denormFloat(debitPtr)
+		debit := denormMoney(debitPtr)
 
 		// Handle deposit number
 		depositNumber := ""
@@ -205,29 +235,35 @@ func RunImportDepositCmd(args []string) {
 		if invoiceNumberPtr != nil {
 			invoiceNumber := strings.TrimSpace(*invoiceNumberPtr)
 			if invoiceNumber != "" {
-				if cached, ok := invoiceCache[invoiceNumber]; ok {
-					salesInvoiceID = cached
-				} else {
-					var invID int64
+				invoice, ok := invoiceCache[invoiceNumber]
+				if !ok {
+					var inv DepositRefData
 					err = tx.QueryRow(`
-						SELECT sales_invoice_id 
+						SELECT sales_invoice_id, outlet_id, branch_id
 						FROM list_sales_invoice 
 						WHERE sales_invoice_number = ? 
 						LIMIT 1
-					`, invoiceNumber).Scan(&invID)
+					`, invoiceNumber).Scan(&inv.ID, &inv.OutletID, &inv.BranchID)
 
 					if err == sql.ErrNoRows {
-						salesInvoiceID = nil
 						invoiceCache[invoiceNumber] = nil
 					} else if err != nil {
 						_ = tx.Rollback()
 						resp.Message = "error querying sales invoice: " + err.Error()
 						goto FINISH
 					} else {
-						salesInvoiceID = &invID
-						invoiceCache[invoiceNumber] = &invID
+						invoice = &inv
+						invoiceCache[invoiceNumber] = invoice
 					}
 				}
+				if invoice == nil {
+					skippedReport.add(r+1, outletCode, depositNumber, "invoice "+invoiceNumber+" tidak ditemukan, deposit tanpa link invoice")
+				} else if msg := invoice.mismatch(outletID, branch.BranchID); msg != "" {
+					skippedReport.add(r+1, outletCode, depositNumber, "invoice "+invoiceNumber+" "+msg)
+					continue
+				} else {
+					salesInvoiceID = &invoice.ID
+				}
 			}
 		}
 
@@ -241,32 +277,70 @@ func RunImportDepositCmd(args []string) {
 					depositNumber = returnInvoiceNumber
 				}
 
-				if cached, ok := returnInvoiceCache[returnInvoiceNumber]; ok {
-					returnInvoiceID = cached
-				} else {
-					var retInvID int64
+				returnInvoice, ok := returnInvoiceCache[returnInvoiceNumber]
+				if !ok {
+					var ret DepositRefData
 					err = tx.QueryRow(`
-						SELECT return_invoice_id 
+						SELECT return_invoice_id, outlet_id, branch_id
 						FROM list_invoice_return 
 						WHERE return_number = ? 
 						LIMIT 1
-					`, returnInvoiceNumber).Scan(&retInvID)
+					`, returnInvoiceNumber).Scan(&ret.ID, &ret.OutletID, &ret.BranchID)
 
 					if err == sql.ErrNoRows {
-						returnInvoiceID = nil
 						returnInvoiceCache[returnInvoiceNumber] = nil
 					} else if err != nil {
 						_ = tx.Rollback()
 						resp.Message = "error querying return invoice: " + err.Error()
 						goto FINISH
 					} else {
-						returnInvoiceID = &retInvID
-						returnInvoiceCache[returnInvoiceNumber] = &retInvID
+						returnInvoice = &ret
+						returnInvoiceCache[returnInvoiceNumber] = returnInvoice
+					}
+				}
+				if returnInvoice == nil {
+					skippedReport.add(r+1, outletCode, depositNumber, "retur "+returnInvoiceNumber+" tidak ditemukan, deposit tanpa link retur")
+				} else if msg := returnInvoice.mismatch(outletID, branch.BranchID); msg != "" {
+					skippedReport.add(r+1, outletCode, depositNumber, "retur "+returnInvoiceNumber+" "+msg)
+					continue
+				} else {
+					// retur yang kreditnya sudah diposting oleh invoice-return
+					// (atau baris lain di file ini) tidak boleh dihitung dua kali
+					booked := bookedReturns[returnInvoice.ID]
+					if !booked {
+						err = tx.QueryRow("SELECT COUNT(*) > 0 FROM list_outlet_deposit WHERE return_invoice_id = ?", returnInvoice.ID).Scan(&booked)
+						if err != nil {
+							_ = tx.Rollback()
+							resp.Message = "error checking return deposit: " + err.Error()
+							goto FINISH
+						}
 					}
+					if booked {
+						skippedReport.add(r+1, outletCode, depositNumber, "retur "+returnInvoiceNumber+" sudah punya deposit/kredit retur")
+						continue
+					}
+					bookedReturns[returnInvoice.ID] = true
+					returnInvoiceID = &returnInvoice.ID
 				}
 			}
 		}
 
+		// Running balance per outlet, starting from what is already in the DB
+		balance, ok := balances[outletCode]
+		if !ok {
+			balance = &DepositBalanceData{}
+			err = tx.QueryRow("SELECT COALESCE(SUM(debit - credit), 0) FROM list_outlet_deposit WHERE outlet_id = ?", outletID).Scan(&balance.Opening)
+			if err != nil {
+				_ = tx.Rollback()
+				resp.Message = "error querying outlet deposit balance: " + err.Error()
+				goto FINISH
+			}
+			balances[outletCode] = balance
+			balanceOrder = append(balanceOrder, outletCode)
+		}
+		balance.Rows++
+		balance.Debit += debit
+
 		createdAt := time.Now().Format("2006-01-02 15:04:05")
 
 		// Prepare row values in same order as cols
@@ -321,9 +395,18 @@ func RunImportDepositCmd(args []string) {
 		goto FINISH
 	}
 
+	for _, code := range balanceOrder {
+		b := balances[code]
+		balanceReport.add(code, b.Rows, b.Opening, b.Debit, b.Opening+b.Debit)
+		totalDeposit += b.Debit
+	}
+	if err := writeReports(*reportPath, balanceReport, skippedReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import Deposit Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted. Execution Time: %.4fs", insertedCount, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted for %d outlets, total deposit %s, %d rows skipped. Execution Time: %.4fs", insertedCount, len(balanceOrder), totalDeposit, skippedReport.count(), time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
@@ -335,3 +418,28 @@ FINISH:
 type BranchData struct {
 	BranchID int64
 }
+
+// DepositRefData is an invoice or return a deposit row links to.
+type DepositRefData struct {
+	ID       int64
+	OutletID int64
+	BranchID int64
+}
+
+// mismatch explains why the document cannot back a deposit of this outlet
+// and branch, or returns "" when it can.
+func (d *DepositRefData) mismatch(outletID, branchID int64) string {
+	if d.OutletID != outletID {
+		return "milik outlet lain"
+	}
+	if d.BranchID != branchID {
+		return "milik cabang lain"
+	}
+	return ""
+}
+
+type DepositBalanceData struct {
+	Rows    int
+	Opening Money
+	Debit   Money
+}
@@ -0,0 +1,509 @@
+package src
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// RunDepositApplyCmd allocates outlet deposit balances (and return credits
+// that are not booked as deposit yet) to open invoices of the same outlet
+// and branch. Allocation follows a mapping file when given, otherwise the
+// oldest due invoice is paid first.
+func RunDepositApplyCmd(args []string) {
+	fs := flag.NewFlagSet("deposit-apply", flag.ExitOnError)
+	mappingPath := fs.String("mapping", "", "xlsx mapping: outlet_code, invoice_number, amount (optional, default oldest-due-first)")
+	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
+	adminID := fs.Int("admin-id", 1, "createdBy admin id")
+	sheetName := fs.String("sheet", "", "mapping sheet name (optional)")
+	dateArg := fs.String("date", "", "settlement date YYYY-MM-DD (default today)")
+	includeReturns := fs.Bool("include-returns", false, "book return credits from list_invoice_return that have no deposit yet as deposit before allocating")
+	tolerance := fs.String("tolerance", "1", "amounts at or below this are treated as settled")
+	onlyCodes := fs.String("only-codes", "", "only allocate for these outlet codes (comma list or file)")
+	excludeCodes := fs.String("exclude-codes", "", "skip these outlet codes (comma list or file)")
+	reportPath := fs.String("report", "", "path to xlsx report of allocations and remaining deposit (optional)")
+	dryRun := fs.Bool("dry-run", false, "report the allocation and roll back")
+	numberingFormat := fs.String("numbering-format", "", "document_code=format of STL_DRAFT and STL numbers as the app writes them, one # per sequence digit, e.g. STL=STL/{BRANCH}/{YY}{MM}/##### (comma list or file, required)")
+	fs.Parse(args)
+
+	start := time.Now()
+	resp := Response{Success: false}
+	allocatedCount := 0
+	returnReport := newImportReport("Kredit Retur", "No Retur", "Kode Outlet", "Jumlah")
+	allocationReport := newImportReport("Alokasi Deposit", "Kode Outlet", "No Invoice", "No Settlement", "Jumlah", "Sisa Invoice", "Keterangan")
+	remainingReport := newImportReport("Sisa Deposit", "Kode Outlet", "Cabang", "Saldo Awal", "Dialokasikan", "Sisa Deposit")
+
+	if *dsn == "" {
+		resp.Message = "dsn is required"
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	toleranceAmount, err := parseMoneyFlag("tolerance", *tolerance)
+	if err != nil {
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	settlementDate := time.Now().Format("2006-01-02")
+	if *dateArg != "" {
+		if _, err := time.Parse("2006-01-02", *dateArg); err != nil {
+			resp.Message = "invalid date: " + *dateArg
+			out, _ := json.Marshal(resp)
+			fmt.Println(string(out))
+			os.Exit(1)
+		}
+		settlementDate = *dateArg
+	}
+	codes, err := newCodeFilter(*onlyCodes, *excludeCodes)
+	if err != nil {
+		resp.Message = "error reading code filter: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	numberingPairs, err := loadKeyValueList(*numberingFormat)
+	var numberingFormats map[string]NumberingFormat
+	if err == nil {
+		numberingFormats, err = parseNumberingFormats(numberingPairs, DocSettlementDraft, DocSettlement)
+	}
+	if err != nil {
+		resp.Message = "invalid numbering-format: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	var mappingRows [][]string
+	if *mappingPath != "" {
+		f, err := excelize.OpenFile(*mappingPath)
+		if err != nil {
+			resp.Message = "error opening file: " + err.Error()
+			out, _ := json.Marshal(resp)
+			fmt.Println(string(out))
+			os.Exit(1)
+		}
+		sheet := *sheetName
+		if sheet == "" {
+			sheet = f.GetSheetName(0)
+		}
+		mappingRows, err = f.GetRows(sheet)
+		f.Close()
+		if err != nil {
+			resp.Message = "error reading sheet rows: " + err.Error()
+			out, _ := json.Marshal(resp)
+			fmt.Println(string(out))
+			os.Exit(1)
+		}
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		resp.Message = "db open error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		resp.Message = "db begin error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	numbers := newNumberingService(tx, numberingFormats)
+	outstanding := newOutstandingTracker(tx)
+	pools := map[string]*DepositPool{}
+	poolOrder := []string{}
+
+	if *includeReturns {
+		if err = bookReturnCredits(tx, codes, *adminID, returnReport); err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error booking return credits: " + err.Error()
+			goto FINISH
+		}
+	}
+
+	pools, poolOrder, err = loadDepositPools(tx, codes, toleranceAmount)
+	if err != nil {
+		_ = tx.Rollback()
+		resp.Message = "error loading deposit balances: " + err.Error()
+		goto FINISH
+	}
+
+	if mappingRows != nil {
+		err = allocateDepositsByMapping(tx, mappingRows, pools, outstanding, codes, toleranceAmount, allocationReport)
+	} else {
+		err = allocateDepositsOldestDue(tx, pools, poolOrder, outstanding, toleranceAmount)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		resp.Message = "error allocating deposits: " + err.Error()
+		goto FINISH
+	}
+
+	for _, key := range poolOrder {
+		pool := pools[key]
+		if len(pool.Allocations) > 0 {
+			settlementNumber, err := writeDepositSettlement(tx, numbers, pool, settlementDate, *adminID)
+			if err != nil {
+				_ = tx.Rollback()
+				resp.Message = fmt.Sprintf("error writing deposit settlement for %s: %s", pool.OutletCode, err.Error())
+				goto FINISH
+			}
+			for _, a := range pool.Allocations {
+				allocationReport.add(pool.OutletCode, a.InvoiceNumber, settlementNumber, a.Amount, a.Left, "dialokasikan")
+				allocatedCount++
+			}
+		}
+		remainingReport.add(pool.OutletCode, pool.BranchID, pool.Balance, pool.Allocated, pool.Balance-pool.Allocated)
+	}
+
+	if *dryRun {
+		_ = tx.Rollback()
+	} else if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		resp.Message = "db commit error: " + err.Error()
+		goto FINISH
+	}
+
+	if err := writeReports(*reportPath, allocationReport, remainingReport, returnReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
+	resp.Success = true
+	resp.Message = "Apply Deposit Success"
+	if *dryRun {
+		resp.Message = "Apply Deposit Dry Run (rolled back)"
+	}
+	resp.MessageDetail = fmt.Sprintf("Total %d invoice allocations for %d outlets, %d return credits booked. Execution Time: %.4fs", allocatedCount, len(poolOrder), returnReport.count(), time.Since(start).Seconds())
+
+FINISH:
+	out, _ := json.Marshal(resp)
+	fmt.Println(string(out))
+	log.Printf("deposit apply complete: %d allocations, time=%.4fs\n", allocatedCount, time.Since(start).Seconds())
+}
+
+// bookReturnCredits writes a retur deposit (debit) for every return that has
+// no deposit yet, so its credit joins the outlet deposit balance. A return
+// deducted from an invoice by invoice-return was booked as deposit and used
+// there, so returnDepositExists covers it as well.
+func bookReturnCredits(tx *sql.Tx, codes *codeFilter, adminID int, report *importReport) error {
+	rows, err := tx.Query(`
+		SELECT r.return_invoice_id, r.return_number, r.return_date, r.branch_id, r.outlet_id, o.outlet_code, r.total_return
+		FROM list_invoice_return r
+		JOIN list_outlet o ON o.outlet_id = r.outlet_id
+		WHERE r.total_return > 0
+		ORDER BY r.return_date, r.return_invoice_id
+	`)
+	if err != nil {
+		return err
+	}
+	credits := []ReturnCreditData{}
+	for rows.Next() {
+		var c ReturnCreditData
+		var returnDate sql.NullTime
+		if err := rows.Scan(&c.ReturnInvoiceID, &c.ReturnNumber, &returnDate, &c.BranchID, &c.OutletID, &c.OutletCode, &c.Amount); err != nil {
+			rows.Close()
+			return err
+		}
+		if !codes.allows(c.OutletCode) {
+			continue
+		}
+		if returnDate.Valid {
+			c.ReturnDate = returnDate.Time.Format("2006-01-02")
+		}
+		credits = append(credits, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range credits {
+		c := &credits[i]
+		exists, err := returnDepositExists(tx, c.ReturnInvoiceID, c.ReturnNumber)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if err := insertReturnDeposit(tx, c, "DEPOSIT INVOICE RETUR", adminID); err != nil {
+			return err
+		}
+		report.add(c.ReturnNumber, c.OutletCode, c.Amount)
+	}
+	return nil
+}
+
+// loadDepositPools returns the positive deposit balance of every outlet and
+// branch, keyed by depositPoolKey.
+func loadDepositPools(tx *sql.Tx, codes *codeFilter, tolerance Money) (map[string]*DepositPool, []string, error) {
+	rows, err := tx.Query(`
+		SELECT d.outlet_id, o.outlet_code, d.branch_id, SUM(d.debit - d.credit)
+		FROM list_outlet_deposit d
+		JOIN list_outlet o ON o.outlet_id = d.outlet_id
+		GROUP BY d.outlet_id, o.outlet_code, d.branch_id
+		HAVING SUM(d.debit - d.credit) > ?
+		ORDER BY o.outlet_code, d.branch_id
+	`, tolerance)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	pools := map[string]*DepositPool{}
+	order := []string{}
+	for rows.Next() {
+		var p DepositPool
+		if err := rows.Scan(&p.OutletID, &p.OutletCode, &p.BranchID, &p.Balance); err != nil {
+			return nil, nil, err
+		}
+		if !codes.allows(p.OutletCode) {
+			continue
+		}
+		key := depositPoolKey(p.OutletID, p.BranchID)
+		pools[key] = &p
+		order = append(order, key)
+	}
+	return pools, order, rows.Err()
+}
+
+func depositPoolKey(outletID, branchID int64) string {
+	return fmt.Sprintf("%d|%d", outletID, branchID)
+}
+
+// allocateDepositsOldestDue pays the open invoices of each pool, oldest due
+// date first, until the deposit runs out.
+func allocateDepositsOldestDue(tx *sql.Tx, pools map[string]*DepositPool, order []string, outstanding *outstandingTracker, tolerance Money) error {
+	for _, key := range order {
+		pool := pools[key]
+		rows, err := tx.Query(`
+			SELECT sales_invoice_id, sales_invoice_number, amount
+			FROM list_sales_invoice
+			WHERE outlet_id = ? AND branch_id = ?
+			ORDER BY COALESCE(snapshot_invoice_due_date, sales_invoice_date), sales_invoice_id
+		`, pool.OutletID, pool.BranchID)
+		if err != nil {
+			return err
+		}
+		invoices := []InvoiceSettlementData{}
+		numbers := map[int64]string{}
+		for rows.Next() {
+			var inv InvoiceSettlementData
+			var number string
+			if err := rows.Scan(&inv.SalesInvoiceID, &number, &inv.Amount); err != nil {
+				rows.Close()
+				return err
+			}
+			invoices = append(invoices, inv)
+			numbers[inv.SalesInvoiceID] = number
+		}
+		rows.Close()
+
+		for _, inv := range invoices {
+			if pool.available() <= tolerance {
+				break
+			}
+			left, err := outstanding.remaining(inv.SalesInvoiceID, numbers[inv.SalesInvoiceID], inv.Amount)
+			if err != nil {
+				return err
+			}
+			if left <= tolerance {
+				continue
+			}
+			pool.allocate(inv.SalesInvoiceID, numbers[inv.SalesInvoiceID], minMoney(left, pool.available()), outstanding)
+		}
+	}
+	return nil
+}
+
+// allocateDepositsByMapping follows the mapping sheet (0 outlet_code,
+// 1 invoice_number, 2 amount). An empty amount pays what is open.
+func allocateDepositsByMapping(tx *sql.Tx, rows [][]string, pools map[string]*DepositPool, outstanding *outstandingTracker, codes *codeFilter, tolerance Money, report *importReport) error {
+	for r := 1; r < len(rows); r++ { // skip header
+		rowData := rows[r]
+		getCol := func(idx int) *string {
+			if idx < len(rowData) {
+				return checkIsTrueEmpty(rowData[idx])
+			}
+			return nil
+		}
+
+		outletCode := getString(getCol(0))
+		invoiceNumber := getString(getCol(1))
+		if outletCode == "" && invoiceNumber == "" {
+			break
+		}
+		if !codes.allows(outletCode) {
+			continue
+		}
+		if invoiceNumber == "" {
+			report.add(outletCode, nil, nil, nil, nil, fmt.Sprintf("baris %d: nomor invoice kosong", r+1))
+			continue
+		}
+
+		var inv InvoiceSettlementData
+		var invOutletCode string
+		err := tx.QueryRow(`
+			SELECT i.sales_invoice_id, i.branch_id, i.outlet_id, i.amount, o.outlet_code
+			FROM list_sales_invoice i
+			JOIN list_outlet o ON o.outlet_id = i.outlet_id
+			WHERE i.sales_invoice_number = ?
+			LIMIT 1
+		`, invoiceNumber).Scan(&inv.SalesInvoiceID, &inv.BranchID, &inv.OutletID, &inv.Amount, &invOutletCode)
+		if err == sql.ErrNoRows {
+			report.add(outletCode, invoiceNumber, nil, nil, nil, "invoice tidak ditemukan")
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !strings.EqualFold(invOutletCode, outletCode) {
+			report.add(outletCode, invoiceNumber, nil, nil, nil, "invoice milik outlet "+invOutletCode)
+			continue
+		}
+
+		pool := pools[depositPoolKey(inv.OutletID, inv.BranchID)]
+		if pool == nil || pool.available() <= tolerance {
+			report.add(outletCode, invoiceNumber, nil, nil, nil, "tidak ada sisa deposit di cabang invoice")
+			continue
+		}
+		left, err := outstanding.remaining(inv.SalesInvoiceID, invoiceNumber, inv.Amount)
+		if err != nil {
+			return err
+		}
+		if left <= tolerance {
+			report.add(outletCode, invoiceNumber, nil, nil, left, "invoice sudah lunas")
+			continue
+		}
+
+		amount := left
+		if p := getCol(2); p != nil {
+			if requested := denormMoney(p); requested > 0 && requested < amount {
+				amount = requested
+			}
+		}
+		if amount > pool.available() {
+			report.add(outletCode, invoiceNumber, nil, amount, left, "deposit kurang, dialokasikan sebagian")
+			amount = pool.available()
+		}
+		pool.allocate(inv.SalesInvoiceID, invoiceNumber, amount, outstanding)
+	}
+	return nil
+}
+
+// writeDepositSettlement books the allocations of one pool as a single
+// settlement paid by deposit, with a deposit credit per invoice.
+func writeDepositSettlement(tx *sql.Tx, numbers *numberingService, pool *DepositPool, settlementDate string, adminID int) (string, error) {
+	docDate := numberingDate(settlementDate)
+	draftNumber, err := numbers.next(DocSettlementDraft, pool.BranchID, docDate)
+	if err != nil {
+		return "", err
+	}
+	settlementNumber, err := numbers.next(DocSettlement, pool.BranchID, docDate)
+	if err != nil {
+		return "", err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO list_settlement (
+			settlement_date, settlement_draft_number, settlement_number,
+			debt_collection_id, cashier_receipt_id, settlement_status_id,
+			branch_id, createdAt, createdBy
+		) VALUES (?, ?, ?, NULL, NULL, ?, ?, NOW(), ?)
+	`, settlementDate, draftNumber, settlementNumber, SettlementStatusApproved, pool.BranchID, adminID)
+	if err != nil {
+		return "", err
+	}
+	settlementID, _ := res.LastInsertId()
+
+	res, err = tx.Exec(`
+		INSERT INTO list_settlement_group (
+			settlement_id, outlet_id, payment_method_id, settlement_amount,
+			giro_number, giro_due_date
+		) VALUES (?, ?, ?, ?, NULL, NULL)
+	`, settlementID, pool.OutletID, PaymentMethodDeposit, pool.Allocated)
+	if err != nil {
+		return "", err
+	}
+	settlementGroupID, _ := res.LastInsertId()
+
+	for _, a := range pool.Allocations {
+		_, err = tx.Exec(`
+			INSERT INTO rel_settle_invoice (
+				sales_invoice_id, settlement_id, settlement_group_id,
+				payment_amount, rounding_amount, outstanding_balance
+			) VALUES (?, ?, ?, ?, 0, ?)
+		`, a.SalesInvoiceID, settlementID, settlementGroupID, a.Amount, a.Left+a.Amount)
+		if err != nil {
+			return "", err
+		}
+		_, err = tx.Exec(`
+			INSERT INTO list_outlet_deposit (
+				deposit_date, deposit_number, deposit_type_id, outlet_id,
+				branch_id, deposit_location_id, debit, credit,
+				note, settlement_id, sales_invoice_id, return_invoice_id,
+				createdAt, createdBy
+			) VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, ?, ?, NULL, ?, ?)
+		`, settlementDate, settlementNumber, DepositTypePelunasan, pool.OutletID, pool.BranchID, pool.BranchID, a.Amount,
+			"PEMAKAIAN DEPOSIT", settlementID, a.SalesInvoiceID, time.Now().Format("2006-01-02 15:04:05"), adminID)
+		if err != nil {
+			return "", err
+		}
+	}
+	return settlementNumber, nil
+}
+
+// Helper structs
+type ReturnCreditData struct {
+	ReturnInvoiceID int64
+	ReturnNumber    string
+	ReturnDate      string
+	BranchID        int64
+	OutletID        int64
+	OutletCode      string
+	Amount          Money
+}
+
+type DepositPool struct {
+	OutletID    int64
+	OutletCode  string
+	BranchID    int64
+	Balance     Money
+	Allocated   Money
+	Allocations []DepositAllocation
+}
+
+func (p *DepositPool) available() Money {
+	return p.Balance - p.Allocated
+}
+
+func (p *DepositPool) allocate(salesInvoiceID int64, invoiceNumber string, amount Money, outstanding *outstandingTracker) {
+	outstanding.apply(salesInvoiceID, amount)
+	p.Allocated += amount
+	p.Allocations = append(p.Allocations, DepositAllocation{
+		SalesInvoiceID: salesInvoiceID,
+		InvoiceNumber:  invoiceNumber,
+		Amount:         amount,
+		Left:           outstanding.left[salesInvoiceID],
+	})
+}
+
+type DepositAllocation struct {
+	SalesInvoiceID int64
+	InvoiceNumber  string
+	Amount         Money
+	Left           Money
+}
@@ -9,16 +9,15 @@ import (
 	"os"
 	"strings"
 	"time"
-
-	"github.com/xuri/excelize/v2"
 )
 
 func RunImportDMFCmd(args []string) {
 	fs := flag.NewFlagSet("dmf", flag.ExitOnError)
-	filePath := fs.String("file", "./uploads/dmf.xlsx", "path to xlsx file")
+	filePath := fs.String("file", "./uploads/dmf.xlsx", "path to xlsx file; several files may be given comma separated, rows are imported in date order")
 	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
 	adminID := fs.Int("admin-id", 1, "current admin id")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	reportPath := fs.String("report", "", "path to xlsx report of rejected track rows (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
@@ -30,34 +29,22 @@ func RunImportDMFCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
-	if _, err := os.Stat(*filePath); err != nil {
-		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
-		out, _ := json.Marshal(resp)
-		fmt.Println(string(out))
-		os.Exit(1)
-	}
-
-	f, err := excelize.OpenFile(*filePath)
-	if err != nil {
-		resp.Message = "error opening file: " + err.Error()
-		out, _ := json.Marshal(resp)
-		fmt.Println(string(out))
-		os.Exit(1)
+	paths := []string{}
+	for _, p := range strings.Split(*filePath, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
 	}
-	defer f.Close()
-
-	sheet := *sheetName
-	if sheet == "" {
-		sheet = f.GetSheetName(0)
-		if sheet == "" {
-			resp.Message = "no sheet found"
+	for _, p := range paths {
+		if _, err := os.Stat(p); err != nil {
+			resp.Message = fmt.Sprintf("file not found: %s", p)
 			out, _ := json.Marshal(resp)
 			fmt.Println(string(out))
 			os.Exit(1)
 		}
 	}
 
-	rows, err := f.GetRows(sheet)
+	rows, err := readDMFRows(paths, *sheetName)
 	if err != nil {
 		resp.Message = "error reading sheet rows: " + err.Error()
 		out, _ := json.Marshal(resp)
@@ -88,6 +75,8 @@ func RunImportDMFCmd(args []string) {
 		SalesInvoiceID  int64
 		TrackStatus     int
 		InvoicePosition int
+		DateTrack       string
+		AdminTrack      sql.NullInt64
 	}
 
 	type GroupDMF struct {
@@ -103,9 +92,14 @@ func RunImportDMFCmd(args []string) {
 	}
 
 	groupDMFList := make(map[string]*GroupDMF)
-
-	for r := 1; r < len(rows); r++ { // skip header row (index 0)
-		cols := rows[r]
+	groupOrder := []string{}
+	invoiceStates := make(map[int64]*InvoiceTrackState)
+	invoiceOrder := []int64{}
+	historyIDs := make(map[string]int64)
+	rejectedReport := newImportReport("Track Ditolak", "File", "Baris", "Tanggal", "No Invoice", "Status", "Keterangan")
+
+	for _, dmfRow := range rows { // already without header, in date order
+		cols := dmfRow.Cols
 		getCol := func(idx int) *string {
 			if idx < len(cols) {
 				return checkIsTrueEmpty(cols[idx])
@@ -127,10 +121,14 @@ func RunImportDMFCmd(args []string) {
 		// col[1] = dmf_type
 		dmfTypePtr := getCol(1)
 		if dmfTypePtr == nil {
-			break
+			continue
 		}
 
 		dmfDate := parseDateForSQL(datePtr)
+		if dmfDate == nil {
+			fmt.Println("Tanggal DMF tidak valid:", *datePtr)
+			continue
+		}
 
 		// Parse DMF type
 		dmfType := 0
@@ -262,38 +260,35 @@ func RunImportDMFCmd(args []string) {
 			goto FINISH
 		}
 
-		// col[9] = track_status
-		trackStatus := 0
-		trackStatusPtr := getCol(9)
-		if trackStatusPtr != nil {
-			trackStatusStr := strings.ToLower(*trackStatusPtr)
-			if trackStatusStr == "dijadwalkan" || trackStatusStr == "diserahkan ke piutang" {
-				trackStatus = 1
-			} else if trackStatusStr == "dalam perjalanan" {
-				trackStatus = 2
-			} else if trackStatusStr == "diterima" || trackStatusStr == "diterima oleh piutang" {
-				trackStatus = 3
-			} else if trackStatusStr == "dibatalkan transaksinya" {
-				trackStatus = 4
-			} else if trackStatusStr == "penjadwalan ulang" {
-				trackStatus = 5
-			}
+		// col[9] = track_status, col[10] = invoice_position
+		trackStatus, impliedPosition, err := parseTrackStatus(getCol(9))
+		if err != nil {
+			rejectedReport.add(dmfRow.File, dmfRow.Row, dmfDate, invoiceNumber, getString(getCol(9)), err.Error())
+			continue
+		}
+		invoicePosition, err := parseTrackPosition(getCol(10))
+		if err == nil {
+			invoicePosition, err = resolveTrackPosition(invoicePosition, impliedPosition)
+		}
+		if err != nil {
+			rejectedReport.add(dmfRow.File, dmfRow.Row, dmfDate, invoiceNumber, getString(getCol(9)), err.Error())
+			continue
 		}
 
-		// col[10] = invoice_position
-		invoicePosition := 0
-		invoicePosPtr := getCol(10)
-		if invoicePosPtr != nil {
-			invPosStr := strings.ToLower(*invoicePosPtr)
-			if invPosStr == "gudang" {
-				invoicePosition = 1
-			} else if invPosStr == "loper" {
-				invoicePosition = 2
-			} else if invPosStr == "piutang" {
-				invoicePosition = 3
-			} else {
-				invoicePosition = 4
+		// Check the transition against the invoice's current state
+		state, ok := invoiceStates[salesInvoiceID]
+		if !ok {
+			state, err = loadInvoiceTrackState(tx, salesInvoiceID)
+			if err != nil {
+				_ = tx.Rollback()
+				resp.Message = "error querying invoice track state: " + err.Error()
+				goto FINISH
 			}
+			invoiceStates[salesInvoiceID] = state
+		}
+		if err := checkTrackTransition(state, trackStatus, invoicePosition, dmfDate.(string)); err != nil {
+			rejectedReport.add(dmfRow.File, dmfRow.Row, dmfDate, invoiceNumber, getString(getCol(9)), err.Error())
+			continue
 		}
 
 		// col[11] = dmf_admin_name
@@ -313,14 +308,14 @@ func RunImportDMFCmd(args []string) {
 					fmt.Println("Error inserting dmf admin:", errIns)
 				} else {
 					aid, _ = res.LastInsertId()
-					dmfAdminID = sql.NullInt64{Int64: aid}
+					dmfAdminID = sql.NullInt64{Int64: aid, Valid: true}
 				}
 			} else if err != nil {
 				_ = tx.Rollback()
 				resp.Message = "error querying dmf admin: " + err.Error()
 				goto FINISH
 			} else {
-				dmfAdminID = sql.NullInt64{Int64: aid}
+				dmfAdminID = sql.NullInt64{Int64: aid, Valid: true}
 			}
 		}
 
@@ -331,8 +326,17 @@ func RunImportDMFCmd(args []string) {
 		}
 		uniqueValue := *uniqueValuePtr
 
+		if state.Group == "" {
+			invoiceOrder = append(invoiceOrder, salesInvoiceID)
+		}
+		state.Status = trackStatus
+		state.Position = invoicePosition
+		state.Date = dmfDate.(string)
+		state.Group = uniqueValue
+
 		// Build group DMF list
 		if _, exists := groupDMFList[uniqueValue]; !exists {
+			groupOrder = append(groupOrder, uniqueValue)
 			groupDMFList[uniqueValue] = &GroupDMF{
 				DmfDate:       dmfDate.(string),
 				dmfAdminId:    dmfAdminID,
@@ -352,28 +356,36 @@ func RunImportDMFCmd(args []string) {
 			SalesInvoiceID:  salesInvoiceID,
 			TrackStatus:     trackStatus,
 			InvoicePosition: invoicePosition,
+			DateTrack:       dmfDate.(string),
+			AdminTrack:      dmfAdminID,
+		}
+		group := groupDMFList[uniqueValue]
+		group.InvoiceList = append(group.InvoiceList, invoiceObj)
+
+		// The group is marked at its earliest row, by that row's admin
+		if invoiceObj.DateTrack < group.DmfDate || (invoiceObj.DateTrack == group.DmfDate && !group.dmfAdminId.Valid) {
+			group.DmfDate = invoiceObj.DateTrack
+			if dmfAdminID.Valid {
+				group.dmfAdminId = dmfAdminID
+			}
 		}
-		groupDMFList[uniqueValue].InvoiceList = append(groupDMFList[uniqueValue].InvoiceList, invoiceObj)
-
-		// Store dmfDate and dmfAdminID for later use (we'll need to pass these when inserting)
-		// For simplicity, we'll store them in the invoice object or handle separately
-		// Note: In the original PHP, dmfDate and dmfAdminID are used in the final insert loop
-		// We'll need to handle this - for now, let's store them separately
-
-		// Create a temporary map to store these values per unique_value
-		// (This is a simplified approach - in production you might want a better structure)
 	}
 
 	// Now process the grouped DMF list
 	if len(groupDMFList) > 0 {
-		for uniqueVal, item := range groupDMFList {
-			_ = uniqueVal // suppress unused warning
+		for _, uniqueVal := range groupOrder {
+			item := groupDMFList[uniqueVal]
+
+			markedBy := int64(*adminID)
+			if item.dmfAdminId.Valid {
+				markedBy = item.dmfAdminId.Int64
+			}
 
 			// Insert track history
 			res, err := tx.Exec(`INSERT INTO list_sales_invoice_track_history 
 				(track_number, invoice_track_status_id, invoice_track_type_id, branch_id, loper_id, courier_id, receipt_number, markedAt, markedBy, note) 
-				VALUES (?, 1, ?, ?, ?, ?, ?, NOW(), ?, ?)`,
-				uniqueVal, item.DMFType, item.BranchID, item.LoperID, item.CourierID, item.ReceiptNumber, *adminID, item.DMFNote)
+				VALUES (?, 1, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				uniqueVal, item.DMFType, item.BranchID, item.LoperID, item.CourierID, item.ReceiptNumber, item.DmfDate, markedBy, item.DMFNote)
 			if err != nil {
 				_ = tx.Rollback()
 				resp.Message = "Gagal import track history data: " + err.Error()
@@ -389,31 +401,36 @@ func RunImportDMFCmd(args []string) {
 
 			// Insert invoice track history relations
 			for _, invoice := range item.InvoiceList {
-				// Note: We need dmfDate and dmfAdminID here - they should be stored per row
-				// For this conversion, we'll use NOW() for date_track and adminID for admin_track
-				// In production, you'd want to properly handle these from the Excel row
+				adminTrack := int64(*adminID)
+				if invoice.AdminTrack.Valid {
+					adminTrack = invoice.AdminTrack.Int64
+				}
 
 				_, err = tx.Exec(`INSERT INTO rel_track_history_invoice 
 					(track_history_id, outlet_id, sales_invoice_id, track_status_id, track_position_id, date_track, admin_track, track_used_id) 
 					VALUES (?, ?, ?, ?, ?, ?, ?, NULL)`,
-					trackHistoryID, invoice.OutletID, invoice.SalesInvoiceID, invoice.TrackStatus, invoice.InvoicePosition, item.DmfDate, *adminID)
+					trackHistoryID, invoice.OutletID, invoice.SalesInvoiceID, invoice.TrackStatus, invoice.InvoicePosition, invoice.DateTrack, adminTrack)
 				if err != nil {
 					_ = tx.Rollback()
 					resp.Message = "Gagal import invoice track history data: " + err.Error()
 					goto FINISH
 				}
-
-				// Update invoice
-				_, err = tx.Exec(`UPDATE list_sales_invoice 
-					SET track_status_id = ?, track_position_id = ?, track_history_id = ?, loper_id = ? 
-					WHERE sales_invoice_id = ?`,
-					invoice.TrackStatus, invoice.InvoicePosition, trackHistoryID, item.LoperID, invoice.SalesInvoiceID)
-				if err != nil {
-					_ = tx.Rollback()
-					resp.Message = "Gagal melakukan perubahan pada invoice terkait: " + err.Error()
-					goto FINISH
-				}
 			}
+			historyIDs[uniqueVal] = trackHistoryID
+		}
+	}
+
+	// Update each invoice once, to its latest state
+	for _, salesInvoiceID := range invoiceOrder {
+		state := invoiceStates[salesInvoiceID]
+		_, err = tx.Exec(`UPDATE list_sales_invoice 
+			SET track_status_id = ?, track_position_id = ?, track_history_id = ?, loper_id = ? 
+			WHERE sales_invoice_id = ?`,
+			state.Status, state.Position, historyIDs[state.Group], groupDMFList[state.Group].LoperID, salesInvoiceID)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "Gagal melakukan perubahan pada invoice terkait: " + err.Error()
+			goto FINISH
 		}
 	}
 
@@ -424,9 +441,13 @@ func RunImportDMFCmd(args []string) {
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, rejectedReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import DMF Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d groups processed. Execution Time: %.4fs", len(groupDMFList), time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d groups processed, %d rows rejected. Execution Time: %.4fs", len(groupDMFList), rejectedReport.count(), time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
@@ -83,6 +83,14 @@ func RunImportGiroCmd(args []string) {
 		os.Exit(1)
 	}
 
+	if err := requireColumns(tx, "list_giro_check", "0002_giro_check_details.sql", giroDetailColumns...); err != nil {
+		_ = tx.Rollback()
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
 	// Batch containers
 	cols := []string{
 		"giro_number",
@@ -90,6 +98,10 @@ func RunImportGiroCmd(args []string) {
 		"giro_amount",
 		"due_date",
 		"status_id",
+		"bank_name",
+		"account_number",
+		"receive_date",
+		"replacement_giro_number",
 		"createdAt",
 		"createdBy",
 	}
@@ -109,7 +121,8 @@ func RunImportGiroCmd(args []string) {
 		}
 
 		// Ensure minimum columns
-		// indices: 0 giro_number, 1 outlet_code, 2 giro_amount, 4 due_date, 5 giro_status
+		// indices: 0 giro_number, 1 outlet_code, 2 giro_amount, 4 due_date, 5 giro_status,
+		// 6 bank, 7 account number, 8 receive date, 9 replacement giro number (optional)
 		if len(rowData) < 6 {
 			fmt.Println("column lebih kecil dari 6")
 			continue
@@ -128,6 +141,10 @@ func RunImportGiroCmd(args []string) {
 		giroAmountPtr := getCol(2)
 		dueDatePtr := getCol(4)
 		giroStatusPtr := getCol(5)
+		bankNamePtr := getCol(6)
+		accountNumberPtr := getCol(7)
+		receiveDatePtr := getCol(8)
+		replacementPtr := getCol(9)
 
 		giroNumber := strings.TrimSpace(*giroNumberPtr)
 
@@ -138,7 +155,7 @@ func RunImportGiroCmd(args []string) {
 		}
 
 		// Parse giro amount
-		giroAmount := denormFloat(giroAmountPtr)
+		giroAmount := denormMoney(giroAmountPtr)
 
 		// Parse due date
 		dueDate := parseDateForSQL(dueDatePtr)
@@ -147,27 +164,35 @@ func RunImportGiroCmd(args []string) {
 		}
 
 		// Parse giro status
-		statusID := 2 // default: cair
-		if giroStatusPtr != nil {
-			statusStr := strings.ToLower(strings.TrimSpace(*giroStatusPtr))
-			if strings.Contains(statusStr, "belum") || strings.Contains(statusStr, "belum cair") {
-				statusID = 1 // belum cair
-			} else {
-				statusID = 2 // cair
-			}
+		statusID, err := parseGiroStatus(giroStatusPtr)
+		if err != nil {
+			fmt.Println(err.Error(), "giro", giroNumber)
+			continue
+		}
+
+		receiveDate := parseDateForSQL(receiveDatePtr)
+		var replacementGiro interface{}
+		if replacementPtr != nil {
+			replacementGiro = strings.TrimSpace(*replacementPtr)
+		} else if statusID == GiroStatusReplaced {
+			fmt.Println("giro diganti tanpa nomor giro pengganti: ", giroNumber)
 		}
 
 		createdAt := time.Now().Format("2006-01-02 15:04:05")
 
 		// Prepare row values in same order as cols
 		rowVals := []interface{}{
-			giroNumber, // giro_number
-			outletID,   // outlet_id
-			giroAmount, // giro_amount
-			dueDate,    // due_date
-			statusID,   // status_id
-			createdAt,  // createdAt
-			*adminID,   // createdBy
+			giroNumber,       // giro_number
+			outletID,         // outlet_id
+			giroAmount,       // giro_amount
+			dueDate,          // due_date
+			statusID,         // status_id
+			bankNamePtr,      // bank_name
+			accountNumberPtr, // account_number
+			receiveDate,      // receive_date
+			replacementGiro,  // replacement_giro_number
+			createdAt,        // createdAt
+			*adminID,         // createdBy
 		}
 		batchRows = append(batchRows, rowVals)
 
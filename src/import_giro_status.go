@@ -0,0 +1,199 @@
+package src
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// RunGiroStatusCmd moves existing giros to a new status (cair, tolak, batal,
+// ganti) and applies the effect on their settlements.
+func RunGiroStatusCmd(args []string) {
+	fs := flag.NewFlagSet("giro-status", flag.ExitOnError)
+	filePath := fs.String("file", "./uploads/giro-status.xlsx", "path to xlsx file")
+	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
+	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	reportPath := fs.String("report", "", "path to xlsx report of status changes and reversed settlements (optional)")
+	fs.Parse(args)
+
+	start := time.Now()
+	resp := Response{Success: false}
+	updatedCount := 0
+	statusReport := newImportReport("Status Giro", "Baris", "No Giro", "Status Lama", "Status Baru", "Keterangan")
+	reversalReport := newSettlementReversalReport()
+
+	if *dsn == "" {
+		resp.Message = "dsn is required"
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if _, err := os.Stat(*filePath); err != nil {
+		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	f, err := excelize.OpenFile(*filePath)
+	if err != nil {
+		resp.Message = "error opening file: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	sheet := *sheetName
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+		if sheet == "" {
+			resp.Message = "no sheet found"
+			out, _ := json.Marshal(resp)
+			fmt.Println(string(out))
+			os.Exit(1)
+		}
+	}
+
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		resp.Message = "error reading sheet rows: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		resp.Message = "db open error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		resp.Message = "db begin error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	if err := requireColumns(tx, "list_giro_check", "0002_giro_check_details.sql", giroDetailColumns...); err != nil {
+		_ = tx.Rollback()
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	for r := 1; r < len(rows); r++ { // skip header
+		rowData := rows[r]
+
+		getCol := func(idx int) *string {
+			if idx < len(rowData) {
+				return checkIsTrueEmpty(rowData[idx])
+			}
+			return nil
+		}
+
+		// indices: 0 giro_number, 1 status, 2 status date, 3 replacement giro number, 4 note
+		giroNumberPtr := getCol(0)
+		if giroNumberPtr == nil {
+			break
+		}
+		giroNumber := strings.TrimSpace(*giroNumberPtr)
+
+		statusPtr := getCol(1)
+		if statusPtr == nil {
+			statusReport.add(r+1, giroNumber, nil, nil, "status kosong")
+			continue
+		}
+		toStatus, err := parseGiroStatus(statusPtr)
+		if err != nil {
+			statusReport.add(r+1, giroNumber, nil, *statusPtr, err.Error())
+			continue
+		}
+
+		var giro GiroStatusData
+		err = tx.QueryRow(`
+			SELECT giro_id, giro_number, status_id, settlement_id
+			FROM list_giro_check
+			WHERE giro_number = ?
+			LIMIT 1
+		`, giroNumber).Scan(&giro.GiroID, &giro.GiroNumber, &giro.StatusID, &giro.SettlementID)
+		if err == sql.ErrNoRows {
+			statusReport.add(r+1, giroNumber, nil, giroStatusName(toStatus), "giro tidak ditemukan")
+			continue
+		} else if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error querying giro: " + err.Error()
+			goto FINISH
+		}
+
+		if giro.StatusID == toStatus {
+			statusReport.add(r+1, giroNumber, giroStatusName(giro.StatusID), giroStatusName(toStatus), "status sudah sama, dilewati")
+			continue
+		}
+		if !canTransitionGiro(giro.StatusID, toStatus) {
+			statusReport.add(r+1, giroNumber, giroStatusName(giro.StatusID), giroStatusName(toStatus), "perubahan status tidak diizinkan")
+			continue
+		}
+
+		replacement := getString(getCol(3))
+		if toStatus == GiroStatusReplaced && replacement == "" {
+			statusReport.add(r+1, giroNumber, giroStatusName(giro.StatusID), giroStatusName(toStatus), "nomor giro pengganti kosong")
+			continue
+		}
+
+		statusDate := parseDateForSQL(getCol(2))
+		if statusDate == nil {
+			statusDate = time.Now().Format("2006-01-02")
+		}
+
+		err = transitionGiro(tx, &giro, toStatus, statusDate, replacement, getString(getCol(4)), reversalReport)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = fmt.Sprintf("error updating giro %s: %s", giroNumber, err.Error())
+			goto FINISH
+		}
+
+		note := "status diubah"
+		if giro.SettlementID.Valid {
+			if toStatus == GiroStatusCleared {
+				note = "status diubah, pelunasan disetujui"
+			} else {
+				note = "status diubah, pelunasan dibatalkan dan invoice dibuka kembali"
+			}
+		}
+		statusReport.add(r+1, giroNumber, giroStatusName(giro.StatusID), giroStatusName(toStatus), note)
+		updatedCount++
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		resp.Message = "db commit error: " + err.Error()
+		goto FINISH
+	}
+
+	if err := writeReports(*reportPath, statusReport, reversalReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
+	resp.Success = true
+	resp.Message = "Update Giro Status Success"
+	resp.MessageDetail = fmt.Sprintf("Total %d giro updated. Execution Time: %.4fs", updatedCount, time.Since(start).Seconds())
+
+FINISH:
+	out, _ := json.Marshal(resp)
+	fmt.Println(string(out))
+	log.Printf("giro status complete: %d rows, time=%.4fs\n", updatedCount, time.Since(start).Seconds())
+}
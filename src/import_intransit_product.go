@@ -21,6 +21,8 @@ func RunImportSKBCentralIntransitProductCmd(args []string) {
 	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	batchCheck := fs.String("batch-check", BatchCheckWarn, "batch/expiry validation: enforce|warn|off")
+	reportPath := fs.String("report", "", "path to xlsx report of batch/expiry violations (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
@@ -32,6 +34,12 @@ func RunImportSKBCentralIntransitProductCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	if !validBatchCheckMode(*batchCheck) {
+		resp.Message = "invalid batch-check mode: " + *batchCheck
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
 		out, _ := json.Marshal(resp)
@@ -110,6 +118,7 @@ func RunImportSKBCentralIntransitProductCmd(args []string) {
 	// Caches
 	skbCache := make(map[string]*SKBProductData)
 	productCache := make(map[string]int64)
+	batchValidator := newBatchExpiryValidator(*batchCheck, false, time.Now())
 
 	// Batch containers
 	cols := []string{
@@ -211,14 +220,23 @@ func RunImportSKBCentralIntransitProductCmd(args []string) {
 
 		qty := denormInt(qtyPtr)
 		qtyExtra := denormInt(qtyExtraPtr)
-		price := denormFloat(pricePtr)
+		price := denormMoney(pricePtr)
 
 		batchNumber := ""
 		if batchNumberPtr != nil {
 			batchNumber = strings.TrimSpace(*batchNumberPtr)
 		}
 
-		expiredDate := parseDateForSQL(expiredDatePtr)
+		expiredDate, batchOK, err := batchValidator.validate(tx, r+1, productCode, productID, batchNumber, expiredDatePtr)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error validating batch: " + err.Error()
+			goto FINISH
+		}
+		if !batchOK {
+			fmt.Println("Batch / expired tidak valid: ", productCode, batchNumber)
+			continue
+		}
 
 		var referenceTypeId sql.NullInt64
 
@@ -293,9 +311,13 @@ func RunImportSKBCentralIntransitProductCmd(args []string) {
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, batchValidator.report); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import SKB Central Intransit Product Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d items inserted. Execution Time: %.4fs", insertedCount, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d items inserted, %d batch/expiry violations, %d rows skipped. Execution Time: %.4fs", insertedCount, batchValidator.report.count(), batchValidator.skipped, time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
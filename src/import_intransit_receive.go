@@ -0,0 +1,507 @@
+package src
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// SKB status constants
+const (
+	SKBStatusIntransit = 3
+	SKBStatusSelesai   = 4
+)
+
+// STB / stock tx constants used when a branch receives an intransit SKB
+const (
+	STBTypeMutasiPusatCabang = 3
+	TxTypePenerimaanMutasi   = 3
+)
+
+func RunImportSKBIntransitReceiveCmd(args []string) {
+	fs := flag.NewFlagSet("intransit-receive", flag.ExitOnError)
+	filePath := fs.String("file", "./uploads/intransit-receive.xlsx", "path to xlsx file")
+	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
+	adminID := fs.Int("admin-id", 1, "createdBy admin id")
+	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	holdDiscrepancy := fs.Bool("hold-discrepancy", false, "leave SKBs with quantity discrepancies in transit instead of completing them")
+	reportPath := fs.String("report", "", "path to xlsx report of discrepancies and skipped rows (optional)")
+	numberingFormat := fs.String("numbering-format", "", "document_code=format of STB numbers as the app writes them, one # per sequence digit, e.g. STB=STB/{BRANCH}/{YY}{MM}/##### (comma list or file, required)")
+	stbTypesArg := fs.String("stb-types", "", "skb_type_id=stb_type_id pairs for SKB types other than mutasi pusat-cabang (comma list or file)")
+	fs.Parse(args)
+
+	start := time.Now()
+	resp := Response{Success: false}
+
+	if *dsn == "" {
+		resp.Message = "dsn is required"
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	numberingPairs, err := loadKeyValueList(*numberingFormat)
+	var numberingFormats map[string]NumberingFormat
+	if err == nil {
+		numberingFormats, err = parseNumberingFormats(numberingPairs, DocSTB)
+	}
+	if err != nil {
+		resp.Message = "invalid numbering-format: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	stbTypePairs, err := loadKeyValueList(*stbTypesArg)
+	var stbTypes map[int]int
+	if err == nil {
+		stbTypes, err = parseSTBTypes(stbTypePairs)
+	}
+	if err != nil {
+		resp.Message = "invalid stb-types: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if _, err := os.Stat(*filePath); err != nil {
+		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	f, err := excelize.OpenFile(*filePath)
+	if err != nil {
+		resp.Message = "error opening file: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	sheet := *sheetName
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+		if sheet == "" {
+			resp.Message = "no sheet found"
+			out, _ := json.Marshal(resp)
+			fmt.Println(string(out))
+			os.Exit(1)
+		}
+	}
+
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		resp.Message = "error reading sheet rows: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		resp.Message = "db open error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		resp.Message = "db begin error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	discrepancyReport := newImportReport("Selisih Qty", "SKB", "Kode Produk", "Batch", "Extra", "Qty Kirim", "Qty Terima", "Selisih")
+	skippedReport := newImportReport("Dilewati", "Baris", "SKB", "Keterangan")
+
+	// group rows per SKB, keeping file order
+	groupList := []*SKBReceiveGroup{}
+	groupIndex := make(map[string]*SKBReceiveGroup)
+
+	for r := 1; r < len(rows); r++ { // skip header
+		rowData := rows[r]
+
+		getCol := func(idx int) *string {
+			if idx < len(rowData) {
+				return checkIsTrueEmpty(rowData[idx])
+			}
+			return nil
+		}
+
+		// indices: 0 skb_number, 1 received_date, 2 product_code, 3 batch_number, 4 qty, 5 qty_extra, 6 note
+		if len(rowData) < 5 {
+			fmt.Println("column kurang dari 5")
+			continue
+		}
+
+		skbNumberPtr := getCol(0)
+		productCodePtr := getCol(2)
+		if skbNumberPtr == nil || productCodePtr == nil {
+			skippedReport.add(r+1, getString(skbNumberPtr), "SKB / kode produk kosong")
+			continue
+		}
+		skbNumber := strings.TrimSpace(*skbNumberPtr)
+
+		group, ok := groupIndex[skbNumber]
+		if !ok {
+			group = &SKBReceiveGroup{
+				SKBNumber: skbNumber,
+				Note:      getString(getCol(6)),
+			}
+			groupIndex[skbNumber] = group
+			groupList = append(groupList, group)
+		}
+
+		// every row of an SKB must carry the same received date (or none)
+		receivedDate, ok := parseDateStrict(getCol(1))
+		if !ok {
+			skippedReport.add(r+1, skbNumber, fmt.Sprintf("tanggal terima tidak valid (%s), SKB dilewati", getString(getCol(1))))
+			group.Rejected = true
+		} else if receivedDate != nil {
+			if group.ReceivedDate == "" {
+				group.ReceivedDate = receivedDate.(string)
+			} else if group.ReceivedDate != receivedDate.(string) {
+				skippedReport.add(r+1, skbNumber, fmt.Sprintf("tanggal terima %s berbeda dengan baris lain (%s), SKB dilewati", receivedDate, group.ReceivedDate))
+				group.Rejected = true
+			}
+		}
+
+		group.Lines = append(group.Lines, SKBReceiveLine{
+			Row:         r + 1,
+			ProductCode: strings.TrimSpace(*productCodePtr),
+			BatchNumber: strings.TrimSpace(getString(getCol(3))),
+			Qty:         denormInt(getCol(4)),
+			QtyExtra:    denormInt(getCol(5)),
+		})
+	}
+
+	productCache := make(map[string]int64)
+	batchCache := make(map[string]int64)
+	numbers := newNumberingService(tx, numberingFormats)
+	receivedCount := 0
+	heldCount := 0
+
+	for _, group := range groupList {
+		if group.Rejected {
+			continue
+		}
+		if group.ReceivedDate == "" {
+			skippedReport.add(group.Lines[0].Row, group.SKBNumber, "tanggal terima kosong, SKB dilewati")
+			continue
+		}
+		status, err := receiveIntransitSKB(tx, group, productCache, batchCache, numbers, stbTypes, *adminID, *holdDiscrepancy, discrepancyReport, skippedReport)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = fmt.Sprintf("error receiving skb %s: %s", group.SKBNumber, err.Error())
+			goto FINISH
+		}
+		switch status {
+		case skbReceiveDone:
+			receivedCount++
+		case skbReceiveHeld:
+			heldCount++
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		resp.Message = "db commit error: " + err.Error()
+		goto FINISH
+	}
+
+	if err := writeReports(*reportPath, discrepancyReport, skippedReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
+	resp.Success = true
+	resp.Message = "Import SKB Intransit Receive Success"
+	resp.MessageDetail = fmt.Sprintf("Total %d SKB received, %d held, %d discrepancy lines, %d rows skipped. Execution Time: %.4fs",
+		receivedCount, heldCount, discrepancyReport.count(), skippedReport.count(), time.Since(start).Seconds())
+
+FINISH:
+	out, _ := json.Marshal(resp)
+	fmt.Println(string(out))
+	log.Printf("import skb intransit receive complete: %d skb, time=%.4fs\n", receivedCount, time.Since(start).Seconds())
+}
+
+type skbReceiveStatus int
+
+const (
+	skbReceiveSkipped skbReceiveStatus = iota
+	skbReceiveHeld
+	skbReceiveDone
+)
+
+// parseSTBTypes reads skb_type_id=stb_type_id pairs on top of the mutasi
+// pusat-cabang pair the importer knows.
+func parseSTBTypes(pairs map[string]string) (map[int]int, error) {
+	types := map[int]int{SKBTypeMutasiPusatCabang: STBTypeMutasiPusatCabang}
+	for k, v := range pairs {
+		skbType, err1 := strconv.Atoi(k)
+		stbType, err2 := strconv.Atoi(v)
+		if err1 != nil || err2 != nil || skbType <= 0 || stbType <= 0 {
+			return nil, fmt.Errorf("invalid pair %s=%s, expected skb_type_id=stb_type_id", k, v)
+		}
+		types[skbType] = stbType
+	}
+	return types, nil
+}
+
+// receiveIntransitSKB books one SKB into its destination warehouse: it writes
+// the receiving STB and its items, debits stock per batch and completes the SKB.
+// The STB gets its own number from the numbering service and the STB type
+// that matches the SKB type; the SKB number is kept as reference_number.
+// Problems with the data are reported and the SKB is skipped; only database
+// errors are returned.
+func receiveIntransitSKB(tx *sql.Tx, group *SKBReceiveGroup, productCache map[string]int64, batchCache map[string]int64,
+	numbers *numberingService, stbTypes map[int]int, adminID int, holdDiscrepancy bool,
+	discrepancyReport *importReport, skippedReport *importReport) (skbReceiveStatus, error) {
+
+	var skb SKBReceiveData
+	err := tx.QueryRow(`
+		SELECT skb_id, skb_status_id, skb_type_id, issuer_id, issuer, destination_type_id, destination_id, destination
+		FROM list_skb
+		WHERE skb_number = ?
+		LIMIT 1
+	`, group.SKBNumber).Scan(&skb.SKBID, &skb.StatusID, &skb.TypeID, &skb.IssuerID, &skb.Issuer,
+		&skb.DestinationTypeID, &skb.DestinationID, &skb.Destination)
+	if err == sql.ErrNoRows {
+		skippedReport.add(group.Lines[0].Row, group.SKBNumber, "SKB tidak ditemukan")
+		return skbReceiveSkipped, nil
+	} else if err != nil {
+		return skbReceiveSkipped, err
+	}
+
+	if skb.StatusID != SKBStatusIntransit {
+		skippedReport.add(group.Lines[0].Row, group.SKBNumber, fmt.Sprintf("SKB tidak dalam status intransit (status %d)", skb.StatusID))
+		return skbReceiveSkipped, nil
+	}
+	if skb.DestinationTypeID != 1 {
+		skippedReport.add(group.Lines[0].Row, group.SKBNumber, "tujuan SKB bukan cabang")
+		return skbReceiveSkipped, nil
+	}
+	stbTypeID, ok := stbTypes[skb.TypeID]
+	if !ok {
+		skippedReport.add(group.Lines[0].Row, group.SKBNumber, fmt.Sprintf("tipe STB untuk SKB tipe %d tidak diketahui, isi --stb-types", skb.TypeID))
+		return skbReceiveSkipped, nil
+	}
+
+	// damaged goods go to the damaged goods warehouse of the destination
+	warehouseTypeID := 1
+	if skb.TypeID == SKBTypeReturBarangRusakKePusat {
+		warehouseTypeID = 2
+	}
+	var warehouseID int64
+	err = tx.QueryRow(`
+		SELECT warehouse_id
+		FROM list_warehouse
+		WHERE branch_id = ? AND warehouse_type_id = ?
+		LIMIT 1
+	`, skb.DestinationID, warehouseTypeID).Scan(&warehouseID)
+	if err == sql.ErrNoRows {
+		skippedReport.add(group.Lines[0].Row, group.SKBNumber, fmt.Sprintf("gudang tujuan tidak ditemukan untuk %s", skb.Destination))
+		return skbReceiveSkipped, nil
+	} else if err != nil {
+		return skbReceiveSkipped, err
+	}
+
+	// what was sent, keyed by product|batch|is_extra
+	sentItems := []*SKBReceiveItem{}
+	sentIndex := make(map[string]*SKBReceiveItem)
+	itemRows, err := tx.Query(`
+		SELECT product_id, batch_number, expired_date, qty, is_extra
+		FROM rel_skb_item
+		WHERE skb_id = ?
+	`, skb.SKBID)
+	if err != nil {
+		return skbReceiveSkipped, err
+	}
+	for itemRows.Next() {
+		var productID, qty int64
+		var isExtra int
+		var batchNumber, expiredDate sql.NullString
+		if err := itemRows.Scan(&productID, &batchNumber, &expiredDate, &qty, &isExtra); err != nil {
+			itemRows.Close()
+			return skbReceiveSkipped, err
+		}
+		key := fmt.Sprintf("%d|%s|%d", productID, batchNumber.String, isExtra)
+		if item, ok := sentIndex[key]; ok {
+			item.QtySent += qty
+			continue
+		}
+		item := &SKBReceiveItem{
+			ProductID:   productID,
+			BatchNumber: batchNumber.String,
+			IsExtra:     isExtra,
+			QtySent:     qty,
+		}
+		if expiredDate.Valid {
+			item.ExpiredDate = parseDateForSQL(&expiredDate.String)
+		}
+		sentIndex[key] = item
+		sentItems = append(sentItems, item)
+	}
+	itemRows.Close()
+
+	if len(sentItems) == 0 {
+		skippedReport.add(group.Lines[0].Row, group.SKBNumber, "SKB tidak memiliki item")
+		return skbReceiveSkipped, nil
+	}
+
+	// apply received quantities from the file
+	for _, line := range group.Lines {
+		productID, ok := productCache[line.ProductCode]
+		if !ok {
+			err := tx.QueryRow("SELECT product_id FROM list_product WHERE product_code = ? LIMIT 1", line.ProductCode).Scan(&productID)
+			if err == sql.ErrNoRows {
+				skippedReport.add(line.Row, group.SKBNumber, fmt.Sprintf("produk %s tidak ditemukan", line.ProductCode))
+				continue
+			} else if err != nil {
+				return skbReceiveSkipped, err
+			}
+			productCache[line.ProductCode] = productID
+		}
+
+		for isExtra, qty := range []int64{line.Qty, line.QtyExtra} {
+			if qty == 0 {
+				continue
+			}
+			key := fmt.Sprintf("%d|%s|%d", productID, line.BatchNumber, isExtra)
+			item, ok := sentIndex[key]
+			if !ok {
+				skippedReport.add(line.Row, group.SKBNumber, fmt.Sprintf("produk %s batch %s tidak ada di SKB", line.ProductCode, line.BatchNumber))
+				continue
+			}
+			item.ProductCode = line.ProductCode
+			item.QtyReceived += qty
+		}
+	}
+
+	hasDiscrepancy := false
+	for _, item := range sentItems {
+		if item.QtyReceived == item.QtySent {
+			continue
+		}
+		hasDiscrepancy = true
+		productCode := item.ProductCode
+		if productCode == "" {
+			_ = tx.QueryRow("SELECT product_code FROM list_product WHERE product_id = ? LIMIT 1", item.ProductID).Scan(&productCode)
+		}
+		discrepancyReport.add(group.SKBNumber, productCode, item.BatchNumber, item.IsExtra, item.QtySent, item.QtyReceived, item.QtyReceived-item.QtySent)
+	}
+
+	if hasDiscrepancy && holdDiscrepancy {
+		skippedReport.add(group.Lines[0].Row, group.SKBNumber, "SKB ditahan karena selisih qty")
+		return skbReceiveHeld, nil
+	}
+
+	createdAt := time.Now().Format("2006-01-02 15:04:05")
+
+	// receiving document
+	stbNumber, err := numbers.next(DocSTB, skb.DestinationID, numberingDate(group.ReceivedDate))
+	if err != nil {
+		return skbReceiveSkipped, err
+	}
+	res, err := tx.Exec(`
+		INSERT INTO list_stb (
+			stb_number, stb_date, stb_status_id, stb_type_id, reference_number,
+			destination_warehouse_id, issuer_type_id, issuer_id, issuer,
+			destination_type_id, destination_id, destination, stb_note,
+			is_return_invoice_sales, createdAt, createdBy
+		) VALUES (?, ?, 2, ?, ?, ?, 1, ?, ?, 1, ?, ?, ?, 0, ?, ?)
+	`, stbNumber, group.ReceivedDate, stbTypeID, group.SKBNumber,
+		warehouseID, skb.IssuerID, skb.Issuer, skb.DestinationID, skb.Destination, group.Note,
+		createdAt, adminID)
+	if err != nil {
+		return skbReceiveSkipped, err
+	}
+	stbID, _ := res.LastInsertId()
+
+	for _, item := range sentItems {
+		if item.QtyReceived <= 0 {
+			continue
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO rel_stb_item (
+				stb_id, skb_id, product_id, unit, qty, qty_sent, batch_number, expired_date, is_extra
+			) VALUES (?, ?, ?, 1, ?, ?, ?, ?, ?)
+		`, stbID, skb.SKBID, item.ProductID, item.QtyReceived, item.QtySent, item.BatchNumber, item.ExpiredDate, item.IsExtra)
+		if err != nil {
+			return skbReceiveSkipped, err
+		}
+
+		// stock debit at the destination warehouse
+		batchID, err := getOrInsertProductBatch(tx, batchCache, item.ProductID, item.BatchNumber, item.ExpiredDate, adminID)
+		if err != nil {
+			return skbReceiveSkipped, err
+		}
+		res, err := tx.Exec(`
+			INSERT INTO list_tx (tx_date, tx_type_id, product_id, warehouse_id, is_consignment, unit, debit, credit, batch_number)
+			VALUES (?, ?, ?, ?, 0, 1, ?, 0, ?)
+		`, group.ReceivedDate, TxTypePenerimaanMutasi, item.ProductID, warehouseID, item.QtyReceived, item.BatchNumber)
+		if err != nil {
+			return skbReceiveSkipped, err
+		}
+		txID, _ := res.LastInsertId()
+		if _, err := tx.Exec("INSERT INTO rel_tx_batch (tx_id, batch_id, qty) VALUES (?, ?, ?)", txID, batchID, item.QtyReceived); err != nil {
+			return skbReceiveSkipped, err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE list_skb SET skb_status_id = ? WHERE skb_id = ?", SKBStatusSelesai, skb.SKBID); err != nil {
+		return skbReceiveSkipped, err
+	}
+
+	fmt.Println("SKB received: ", group.SKBNumber)
+	return skbReceiveDone, nil
+}
+
+// Helper structs
+type SKBReceiveLine struct {
+	Row         int
+	ProductCode string
+	BatchNumber string
+	Qty         int64
+	QtyExtra    int64
+}
+
+type SKBReceiveGroup struct {
+	SKBNumber    string
+	ReceivedDate string
+	Note         string
+	Rejected     bool // a row had an invalid or conflicting received date
+	Lines        []SKBReceiveLine
+}
+
+type SKBReceiveData struct {
+	SKBID             int64
+	StatusID          int
+	TypeID            int
+	IssuerID          int64
+	Issuer            string
+	DestinationTypeID int
+	DestinationID     int64
+	Destination       string
+}
+
+type SKBReceiveItem struct {
+	ProductID   int64
+	ProductCode string
+	BatchNumber string
+	ExpiredDate interface{}
+	IsExtra     int
+	QtySent     int64
+	QtyReceived int64
+}
@@ -24,6 +24,7 @@ type Outlet struct {
 	ID       int64
 	Name     string
 	TopValue string
+	IsPKP    bool
 }
 type Region struct {
 	ID   int64
@@ -51,6 +52,9 @@ func RunImportSalesInvoiceCmd(args []string) {
 	batchSize := fs.Int("batch", 500, "batch insert size")
 	logID := fs.String("log-id", "", "optional log_id to update activity on success")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	onlyCodes := fs.String("only-codes", "", "only import these invoice numbers (comma list or file, one per line)")
+	excludeCodes := fs.String("exclude-codes", "", "skip these invoice numbers (comma list or file, one per line)")
+	taxRulesPath := fs.String("tax-rules", "", "xlsx PPN rule table: effective date, rate, DPP factor, pkp|non-pkp (default built-in rules)")
 
 	fs.Parse(args)
 
@@ -63,6 +67,20 @@ func RunImportSalesInvoiceCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	codes, err := newCodeFilter(*onlyCodes, *excludeCodes)
+	if err != nil {
+		resp.Message = "error reading code list: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	taxRules, err := loadTaxRules(*taxRulesPath)
+	if err != nil {
+		resp.Message = "error reading tax rules: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
 		out, _ := json.Marshal(resp)
@@ -218,6 +236,9 @@ func RunImportSalesInvoiceCmd(args []string) {
 			continue
 		}
 		invoiceNumber := *invoiceNumberPtr
+		if !codes.allows(invoiceNumber) {
+			continue
+		}
 
 		if invoiceNumber == "Freetext" {
 			continue
@@ -305,7 +326,8 @@ func RunImportSalesInvoiceCmd(args []string) {
 		} else {
 			var oid int64
 			var oname, oTopValue sql.NullString
-			err := tx.QueryRow("SELECT outlet_id, outlet_name, top_value FROM list_outlet WHERE outlet_code = ? LIMIT 1", outletCode).Scan(&oid, &oname, &oTopValue)
+			var oIsPKP sql.NullInt64
+			err := tx.QueryRow("SELECT outlet_id, outlet_name, top_value, is_pkp FROM list_outlet WHERE outlet_code = ? LIMIT 1", outletCode).Scan(&oid, &oname, &oTopValue, &oIsPKP)
 			if err == sql.ErrNoRows {
 				log.Printf("Missing outlet: %s (row %d)\n", outletCode, rowIndex)
 				fmt.Println("Missing outlet: ", outletCode)
@@ -315,7 +337,7 @@ func RunImportSalesInvoiceCmd(args []string) {
 				resp.Message = "db error querying outlet: " + err.Error()
 				goto FINISH
 			}
-			no := &Outlet{ID: oid}
+			no := &Outlet{ID: oid, IsPKP: oIsPKP.Int64 == 1}
 			if oname.Valid {
 				no.Name = oname.String
 			}
@@ -481,25 +503,44 @@ func RunImportSalesInvoiceCmd(args []string) {
 			}
 		}
 
-		// amount (col 12) - keep as string numeric; PHP used check_is_true_empty so allow empty => 0
-		amount := "0"
+		// amount (col 12) - PHP used check_is_true_empty so allow empty => 0
+		amount := Money(0)
 		if p := getCol(12); p != nil && *p != "" {
-			amount = denormalizeNumber(p) // denormalizeNumber returns string without thousands separator in your earlier code
+			v, err := parseMoney(denormalizeNumber(p)) // comma is the thousands separator
+			if err != nil {
+				fmt.Println("amount tidak valid: ", *p)
+				continue
+			}
+			amount = v
 		}
 
-		// ppn default 11 (php)
-		ppn := 11
-
 		// discount (col 14)
-		discount := "0"
+		discount := Money(0)
 		if p := getCol(14); p != nil {
 			d := strings.TrimSpace(*p)
-			if d == "" || d == "-" {
-				discount = "0"
-			} else {
-				discount = d
+			if d != "" && d != "-" {
+				v, err := parseMoney(denormalizeNumber(&d))
+				if err != nil {
+					fmt.Println("discount tidak valid: ", *p)
+					continue
+				}
+				discount = v
+			}
+		}
+
+		// ppn dari tabel pajak sesuai tanggal invoice, bisa di-override kolom
+		// ppn (col 13): the PPN amount in total_harga or an explicit rate. A
+		// rate other than the rule's is charged on the full price; invoice-item
+		// derives the dpp the same way from the stored ppn.
+		taxRule := taxRules.resolve(invoiceDate, outlet.IsPKP)
+		if p := getCol(13); p != nil {
+			taxRule, err = taxRule.fromPPNCell(*p, amount-discount)
+			if err != nil {
+				fmt.Println(err.Error(), "invoice", invoiceNumber)
+				continue
 			}
 		}
+		ppn := taxRule.Rate
 
 		// sales_type (col 15)
 		salesTypeRaw := ""
@@ -640,7 +681,7 @@ func RunImportSalesInvoiceCmd(args []string) {
 		// term_days, amount, ppn, cash_discount, createdAt, createdBy, is_legacy]
 
 		// convert numeric strings to appropriate types as needed: PHP used db->escape on many values (strings). We'll keep types as interface{}
-		// For simplicity, we will insert amount and discount as numeric strings (MySQL will cast) — you may change to float64 if desired.
+		// amount and discount are Money and bind as exact decimal strings.
 
 		// skip duplicates in same file processing
 		if _, ok := uniqueInvoiceList[invoiceNumber]; !ok {
@@ -16,9 +16,16 @@ func RunImportSalesInvoiceFeeCmd(args []string) {
 	fs := flag.NewFlagSet("invoice-fee", flag.ExitOnError)
 	filePath := fs.String("file", "./uploads/invoice_fee.xlsx", "path to xlsx file")
 	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
-	// adminID := fs.Int("admin-id", 1, "createdBy admin id")
+	adminID := fs.Int("admin-id", 1, "createdBy admin id for auto-created fee types")
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	feeAliasArg := fs.String("fee-alias", "", "extra fee name aliases as alias=fee_type_name pairs (comma list or file)")
+	createFeeTypes := fs.Bool("create-fee-types", false, "insert fee names missing from list_fee_type instead of skipping the row")
+	tolerance := fs.String("tolerance", "1", "allowed difference between computed and recorded invoice total")
+	stampDuty := fs.String("stamp-duty", DefaultStampDutyAmount.String(), "meterai amount for invoices flagged with stamp duty and no Materai fee")
+	fixTotals := fs.Bool("fix-totals", false, "set the header amount of mismatching invoices to the recomputed total")
+	rounding := fs.String("rounding", RoundPerDocument, "PPN rounding: line (per item line, summed) or document (once on the invoice DPP)")
+	reportPath := fs.String("report", "", "path to xlsx report of fee rows and invoice totals (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
@@ -30,6 +37,33 @@ func RunImportSalesInvoiceFeeCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	toleranceAmount, err := parseMoneyFlag("tolerance", *tolerance)
+	if err != nil {
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	stampDutyAmount, err := parseMoneyFlag("stamp-duty", *stampDuty)
+	if err != nil {
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if !validRoundingMode(*rounding) {
+		resp.Message = "invalid rounding mode: " + *rounding
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	feeAliases, err := loadKeyValueList(*feeAliasArg)
+	if err != nil {
+		resp.Message = "error reading fee aliases: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
 		out, _ := json.Marshal(resp)
@@ -82,9 +116,23 @@ func RunImportSalesInvoiceFeeCmd(args []string) {
 		os.Exit(1)
 	}
 
+	feeTypes, err := newFeeTypeResolver(tx, feeAliases, *createFeeTypes, *adminID)
+	if err != nil {
+		_ = tx.Rollback()
+		resp.Message = "error loading fee types: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
 	insertCols := []string{"sales_invoice_id", "fee_type_id", "amount"}
 	batchRows := [][]interface{}{}
 	insertedCount := 0
+	invoiceCache := make(map[string]int64)
+	feeSeen := make(map[string]int)
+	touchedInvoices := []int64{}
+	feeReport := newImportReport("Biaya Invoice", "Baris", "No Invoice", "Biaya", "Jumlah", "Keterangan")
+	totalReport := newInvoiceReconcileReport()
 
 	for r := 1; r < len(rows); r++ { // skip header
 		cols := rows[r]
@@ -101,24 +149,60 @@ func RunImportSalesInvoiceFeeCmd(args []string) {
 		}
 
 		// --- lookup invoice_id ---
-		var invoiceID int64
-		err = tx.QueryRow("SELECT sales_invoice_id FROM list_sales_invoice WHERE sales_invoice_number = ? LIMIT 1", *invoiceNumber).Scan(&invoiceID)
-		if err == sql.ErrNoRows {
-			fmt.Printf("Invoice tidak ditemukan: %s\n", *invoiceNumber)
-			continue
-		} else if err != nil {
-			_ = tx.Rollback()
-			resp.Message = "error querying invoice: " + err.Error()
-			goto FINISH
+		invoiceID, ok := invoiceCache[*invoiceNumber]
+		if !ok {
+			err = tx.QueryRow("SELECT sales_invoice_id FROM list_sales_invoice WHERE sales_invoice_number = ? LIMIT 1", *invoiceNumber).Scan(&invoiceID)
+			if err == sql.ErrNoRows {
+				fmt.Printf("Invoice tidak ditemukan: %s\n", *invoiceNumber)
+				feeReport.add(r+1, *invoiceNumber, *feeName, nil, "invoice tidak ditemukan")
+				continue
+			} else if err != nil {
+				_ = tx.Rollback()
+				resp.Message = "error querying invoice: " + err.Error()
+				goto FINISH
+			}
+			invoiceCache[*invoiceNumber] = invoiceID
+			touchedInvoices = append(touchedInvoices, invoiceID)
 		}
 
 		// --- determine fee type ---
-		var feeTypeID int64 = 1
-		if *feeName == "Ongkos Kirim" {
-			feeTypeID = 2
+		feeTypeID, created, err := feeTypes.resolve(*feeName)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error creating fee type: " + err.Error()
+			goto FINISH
+		}
+		if feeTypeID == 0 {
+			feeReport.add(r+1, *invoiceNumber, *feeName, nil, "jenis biaya tidak ada di master")
+			continue
+		}
+		if created {
+			feeReport.add(r+1, *invoiceNumber, *feeName, nil, "jenis biaya baru dibuat")
 		}
 
-		amount := denormFloat(feeAmount)
+		amount := denormMoney(feeAmount)
+
+		// --- duplicate fee line, in this file or from an earlier run ---
+		feeKey := fmt.Sprintf("%d|%d", invoiceID, feeTypeID)
+		if firstRow, ok := feeSeen[feeKey]; ok {
+			feeReport.add(r+1, *invoiceNumber, *feeName, amount, fmt.Sprintf("biaya ganda, sama dengan baris %d", firstRow))
+			continue
+		}
+		feeSeen[feeKey] = r + 1
+		var existingAmount Money
+		err = tx.QueryRow("SELECT amount FROM rel_sales_invoice_fees WHERE sales_invoice_id = ? AND fee_type_id = ? LIMIT 1", invoiceID, feeTypeID).Scan(&existingAmount)
+		if err == nil {
+			if existingAmount == amount {
+				feeReport.add(r+1, *invoiceNumber, *feeName, amount, "biaya sudah ada, dilewati")
+			} else {
+				feeReport.add(r+1, *invoiceNumber, *feeName, amount, fmt.Sprintf("biaya sudah ada dengan jumlah berbeda (%s), dilewati", existingAmount))
+			}
+			continue
+		} else if err != sql.ErrNoRows {
+			_ = tx.Rollback()
+			resp.Message = "error checking invoice fee: " + err.Error()
+			goto FINISH
+		}
 
 		batchRows = append(batchRows, []interface{}{
 			invoiceID,
@@ -151,15 +235,26 @@ func RunImportSalesInvoiceFeeCmd(args []string) {
 		insertedCount += len(batchRows)
 	}
 
+	// verify invoice totals now that fees are in
+	if _, err := reconcileInvoices(tx, touchedInvoices, stampDutyAmount, *rounding, toleranceAmount, *fixTotals, totalReport); err != nil {
+		_ = tx.Rollback()
+		resp.Message = "error reconciling invoice total: " + err.Error()
+		goto FINISH
+	}
+
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
 		resp.Message = "db commit error: " + err.Error()
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, feeReport, totalReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import Sales Invoice Fee Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted. Execution Time: %.4fs", insertedCount, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted, %d fee rows reported, %d invoice totals not matching. Execution Time: %.4fs", insertedCount, feeReport.count(), totalReport.count(), time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
@@ -0,0 +1,748 @@
+package src
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Invoice item import modes. Each stage writes its own temp_iteration so a
+// later stage can tell which lines an earlier one already imported.
+const (
+	InvoiceItemModeInitial     = "initial"     // first load of invoice items
+	InvoiceItemModeOutstanding = "outstanding" // items of outstanding invoices, after initial
+	InvoiceItemModeMissing     = "missing"     // items still missing after initial and outstanding
+)
+
+// Merge modes for a row whose product already has a line from the same
+// stage on the order/invoice (e.g. the product appears twice in the file).
+const (
+	InvoiceItemMergeAdd  = "add"  // add qty and qty_extra to the existing line
+	InvoiceItemMergeSkip = "skip" // report and skip the row
+)
+
+var invoiceItemModes = map[string]InvoiceItemModeSpec{
+	InvoiceItemModeInitial: {
+		TempIteration: 1,
+		BatchCheck:    BatchCheckWarn,
+	},
+	InvoiceItemModeOutstanding: {
+		TempIteration:   2,
+		PriorIterations: []int{1},
+		SkipFilledSkb:   true,
+		BatchCheck:      BatchCheckOff,
+	},
+	InvoiceItemModeMissing: {
+		TempIteration:   3,
+		PriorIterations: []int{1, 2},
+		SkipFilledSkb:   true,
+		BatchCheck:      BatchCheckOff,
+	},
+}
+
+var (
+	salesOrderLines   = salesLineTable{Table: "rel_sales_order_item", KeyColumn: "sales_order_id"}
+	salesInvoiceLines = salesLineTable{Table: "rel_sales_invoice_item", KeyColumn: "sales_invoice_id"}
+)
+
+// RunImportSalesInvoiceItemCmd imports order, invoice and SKB items; --mode
+// selects the stage.
+func RunImportSalesInvoiceItemCmd(args []string) {
+	runInvoiceItemImport("invoice-item", "", args)
+}
+
+// RunImportSalesInvoiceProductCmd is the old invoice-product command, the
+// initial stage of invoice-item.
+func RunImportSalesInvoiceProductCmd(args []string) {
+	runInvoiceItemImport("invoice-product", InvoiceItemModeInitial, args)
+}
+
+// RunImportSalesInvoiceProductOutstandingCmd is the old
+// invoice-outstanding-product command, the outstanding stage of invoice-item.
+func RunImportSalesInvoiceProductOutstandingCmd(args []string) {
+	runInvoiceItemImport("invoice-outstanding-product", InvoiceItemModeOutstanding, args)
+}
+
+// RunImportSalesInvoiceProductMissingCmd is the old invoice-product-missing
+// command, the missing stage of invoice-item.
+func RunImportSalesInvoiceProductMissingCmd(args []string) {
+	runInvoiceItemImport("invoice-product-missing", InvoiceItemModeMissing, args)
+}
+
+// runInvoiceItemImport runs the importer under the given command name. A
+// fixed mode comes from an alias; otherwise --mode is required.
+func runInvoiceItemImport(name, fixedMode string, args []string) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	filePath := fs.String("file", "./uploads/invoice_product.xlsx", "path to xlsx file")
+	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
+	adminID := fs.Int("admin-id", 1, "createdBy admin id")
+	batchSize := fs.Int("batch", 500, "log progress every n rows")
+	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	onlyCodes := fs.String("only-codes", "", "only import these invoice numbers (comma list or file, one per line)")
+	excludeCodes := fs.String("exclude-codes", "", "skip these invoice numbers (comma list or file, one per line)")
+	modeName := fs.String("mode", fixedMode, "import stage: initial|outstanding|missing")
+	merge := fs.String("merge", InvoiceItemMergeAdd, "rows for a product already imported in this stage: add|skip")
+	batchCheck := fs.String("batch-check", "", "batch/expiry validation: enforce|warn|off (default warn for initial, off otherwise)")
+	taxRulesPath := fs.String("tax-rules", "", "xlsx PPN rule table: effective date, rate, DPP factor, pkp|non-pkp (default built-in rules)")
+	reconcile := fs.Bool("reconcile", false, "check the header total of every touched invoice against its items after the import")
+	fixTotals := fs.Bool("fix-totals", false, "with --reconcile, set the header amount of mismatching invoices to the recomputed total")
+	tolerance := fs.String("tolerance", "1", "allowed difference between computed and recorded invoice total")
+	stampDuty := fs.String("stamp-duty", DefaultStampDutyAmount.String(), "meterai amount for invoices flagged with stamp duty and no Materai fee")
+	rounding := fs.String("rounding", RoundPerDocument, "PPN rounding: line (per item line, summed) or document (once on the invoice DPP)")
+	reportPath := fs.String("report", "", "path to xlsx report of skipped rows, batch/expiry violations and invoice totals (optional)")
+	fs.Parse(args)
+
+	start := time.Now()
+	resp := Response{Success: false}
+
+	exitWith := func(msg string) {
+		resp.Message = msg
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	if *dsn == "" {
+		exitWith("dsn is required")
+	}
+	toleranceAmount, err := parseMoneyFlag("tolerance", *tolerance)
+	if err != nil {
+		exitWith(err.Error())
+	}
+	stampDutyAmount, err := parseMoneyFlag("stamp-duty", *stampDuty)
+	if err != nil {
+		exitWith(err.Error())
+	}
+	if fixedMode != "" && *modeName != fixedMode {
+		exitWith(fmt.Sprintf("%s always runs in mode %s, use invoice-item for other modes", name, fixedMode))
+	}
+	mode, ok := invoiceItemModes[*modeName]
+	if !ok {
+		exitWith("invalid mode: " + *modeName)
+	}
+	if *merge != InvoiceItemMergeAdd && *merge != InvoiceItemMergeSkip {
+		exitWith("invalid merge mode: " + *merge)
+	}
+	if *batchCheck == "" {
+		*batchCheck = mode.BatchCheck
+	}
+	if !validBatchCheckMode(*batchCheck) {
+		exitWith("invalid batch-check mode: " + *batchCheck)
+	}
+	if !validRoundingMode(*rounding) {
+		exitWith("invalid rounding mode: " + *rounding)
+	}
+	codes, err := newCodeFilter(*onlyCodes, *excludeCodes)
+	if err != nil {
+		exitWith("error reading code list: " + err.Error())
+	}
+	taxRules, err := loadTaxRules(*taxRulesPath)
+	if err != nil {
+		exitWith("error reading tax rules: " + err.Error())
+	}
+	if _, err := os.Stat(*filePath); err != nil {
+		exitWith(fmt.Sprintf("file not found: %s", *filePath))
+	}
+
+	f, err := excelize.OpenFile(*filePath)
+	if err != nil {
+		exitWith("error opening file: " + err.Error())
+	}
+	defer f.Close()
+
+	sheet := *sheetName
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+		if sheet == "" {
+			exitWith("no sheet found")
+		}
+	}
+
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		exitWith("error reading sheet rows: " + err.Error())
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		exitWith("db open error: " + err.Error())
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		exitWith("db begin error: " + err.Error())
+	}
+
+	// prepare statements
+	stmtOrder, err := tx.Prepare(`
+		INSERT INTO rel_sales_order_item
+		(sales_order_id, product_id, quoted_price, discount_value, discount_routine_value, discount_program_value,
+		 discount_routine_branch, discount_program_branch, dpp, unit, qty, qty_extra, temp_iteration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, 0, ?)
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		exitWith("prepare stmt_order failed: " + err.Error())
+	}
+	defer stmtOrder.Close()
+
+	stmtOrderExtra, err := tx.Prepare(`
+		INSERT INTO rel_sales_order_item
+		(sales_order_id, product_id, quoted_price, discount_value, discount_routine_value, discount_program_value,
+		 discount_routine_branch, discount_program_branch, dpp, unit, qty, qty_extra, group_id, temp_iteration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, 0, 1, 0, ?, ?, ?)
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		exitWith("prepare stmt_order_extra failed: " + err.Error())
+	}
+	defer stmtOrderExtra.Close()
+
+	stmtInvoice, err := tx.Prepare(`
+		INSERT INTO rel_sales_invoice_item
+		(sales_invoice_id, product_id, salesman_id, quoted_price, batch_number, discount_value,
+		 discount_routine_value, discount_program_value, discount_routine_branch, discount_program_branch,
+		 dpp, unit, qty, qty_extra, temp_iteration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, 0, ?)
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		exitWith("prepare stmt_invoice failed: " + err.Error())
+	}
+	defer stmtInvoice.Close()
+
+	stmtInvoiceExtra, err := tx.Prepare(`
+		INSERT INTO rel_sales_invoice_item
+		(sales_invoice_id, product_id, salesman_id, quoted_price, batch_number, discount_value,
+		 discount_routine_value, discount_program_value, discount_routine_branch, discount_program_branch,
+		 dpp, unit, qty, qty_extra, group_id, temp_iteration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, 0, 1, 0, ?, ?, ?)
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		exitWith("prepare stmt_invoice_extra failed: " + err.Error())
+	}
+	defer stmtInvoiceExtra.Close()
+
+	stmtSkb, err := tx.Prepare(`
+		INSERT INTO rel_skb_item
+		(skb_id, product_id, unit, qty, quoted_price, batch_number, expired_date, reference_type_id, reference_id)
+		VALUES (?, ?, 1, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		exitWith("prepare stmt_skb failed: " + err.Error())
+	}
+	defer stmtSkb.Close()
+
+	stmtSkbExtra, err := tx.Prepare(`
+		INSERT INTO rel_skb_item
+		(skb_id, product_id, unit, qty, quoted_price, batch_number, expired_date, reference_type_id, reference_id, is_extra)
+		VALUES (?, ?, 1, ?, ?, ?, ?, ?, ?, 1)
+	`)
+	if err != nil {
+		_ = tx.Rollback()
+		exitWith("prepare stmt_skb_extra failed: " + err.Error())
+	}
+	defer stmtSkbExtra.Close()
+
+	// caches
+	orderCache := map[string]int64{}
+	invoiceCache := map[string]SalesInvoiceRef{}
+	skbCache := map[string]int64{}
+	productCache := map[string]int64{}
+	invoiceSKBLinked := map[string]bool{}
+	// whether an SKB already had items before this run
+	skbFilled := map[int64]bool{}
+	batchValidator := newBatchExpiryValidator(*batchCheck, false, time.Now())
+	skippedReport := newImportReport("Dilewati", "Baris", "No Faktur", "Kode Produk", "Keterangan")
+	totalReport := newInvoiceReconcileReport()
+	touchedInvoices := []int64{}
+
+	insertedCount := 0
+
+	for r := 1; r < len(rows); r++ {
+		cols := rows[r]
+
+		if len(cols) < 6 {
+			fmt.Println("coloum lebih kecil dari 6")
+			continue
+		}
+
+		getCol := func(i int) string {
+			if i < len(cols) {
+				return strings.TrimSpace(cols[i])
+			}
+			return ""
+		}
+
+		invoiceNumber := getCol(0)
+		if invoiceNumber == "" {
+			fmt.Println("invoice number kosong")
+			continue
+		}
+		if !codes.allows(invoiceNumber) {
+			continue
+		}
+
+		// order
+		orderID, ok := orderCache[invoiceNumber]
+		if !ok {
+			err := tx.QueryRow("SELECT sales_order_id FROM list_sales_order WHERE sales_number = ? LIMIT 1", invoiceNumber).Scan(&orderID)
+			if err == sql.ErrNoRows {
+				skippedReport.add(r+1, invoiceNumber, getCol(1), "order tidak ditemukan")
+				continue
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				exitWith("error querying order: " + err.Error())
+			}
+			orderCache[invoiceNumber] = orderID
+		}
+
+		// invoice
+		invData, ok := invoiceCache[invoiceNumber]
+		if !ok {
+			var siID, salesmanID, typeInv, isPKP sql.NullInt64
+			var invoiceDate sql.NullTime
+			var ppn Percent
+			err := tx.QueryRow(`
+				SELECT i.sales_invoice_id, i.salesman_id, i.sales_invoice_type_id, i.sales_invoice_date, COALESCE(i.ppn, 0), o.is_pkp
+				FROM list_sales_invoice i
+				LEFT JOIN list_outlet o ON o.outlet_id = i.outlet_id
+				WHERE i.sales_invoice_number = ?
+				LIMIT 1
+			`, invoiceNumber).Scan(&siID, &salesmanID, &typeInv, &invoiceDate, &ppn, &isPKP)
+			if err == sql.ErrNoRows {
+				skippedReport.add(r+1, invoiceNumber, getCol(1), "invoice tidak ditemukan")
+				continue
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				exitWith("error querying invoice: " + err.Error())
+			}
+			invData = SalesInvoiceRef{ID: siID.Int64, Salesman: salesmanID.Int64, TypeInv: typeInv.Int64}
+			// dpp is the taxed base: DPP nilai lain when the invoice has the
+			// rate of a rule with a DPP factor
+			invData.Tax = taxRules.forInvoice(invoiceDate.Time.Format("2006-01-02"), isPKP.Int64 == 1, ppn)
+			invoiceCache[invoiceNumber] = invData
+			touchedInvoices = append(touchedInvoices, invData.ID)
+		}
+
+		// skb
+		skbID, ok := skbCache[invoiceNumber]
+		if !ok {
+			err := tx.QueryRow("SELECT skb_id FROM list_skb WHERE skb_number = ? LIMIT 1", invoiceNumber).Scan(&skbID)
+			if err == sql.ErrNoRows {
+				skippedReport.add(r+1, invoiceNumber, getCol(1), "skb tidak ditemukan")
+				continue
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				exitWith("error querying skb: " + err.Error())
+			}
+			skbCache[invoiceNumber] = skbID
+
+			var countSkb int
+			if err := tx.QueryRow("SELECT COUNT(1) FROM rel_skb_item WHERE skb_id = ?", skbID).Scan(&countSkb); err != nil {
+				_ = tx.Rollback()
+				exitWith("cek existing skb item failed: " + err.Error())
+			}
+			skbFilled[skbID] = countSkb > 0
+		}
+
+		// product
+		productCode := getCol(1)
+		if productCode == "" {
+			fmt.Println("product code kosong")
+			continue
+		}
+
+		productID, ok := productCache[productCode]
+		if !ok {
+			err := tx.QueryRow("SELECT product_id FROM list_product WHERE product_code = ? LIMIT 1", productCode).Scan(&productID)
+			if err == sql.ErrNoRows {
+				res, err2 := tx.Exec("INSERT INTO list_product (product_code, product_name, createdAt, createdBy) VALUES (?, ?, NOW(), ?)",
+					productCode, productCode, *adminID)
+				if err2 != nil {
+					_ = tx.Rollback()
+					exitWith("error inserting product: " + err2.Error())
+				}
+				last, _ := res.LastInsertId()
+				productID = last
+			} else if err != nil {
+				_ = tx.Rollback()
+				exitWith("error querying product: " + err.Error())
+			}
+			productCache[productCode] = productID
+		}
+
+		// lines imported by an earlier stage are left as they are
+		if len(mode.PriorIterations) > 0 {
+			orderDone, err := salesLineExists(tx, salesOrderLines, orderID, productID, mode)
+			if err != nil {
+				_ = tx.Rollback()
+				exitWith("cek existing order item failed: " + err.Error())
+			}
+			invoiceDone, err := salesLineExists(tx, salesInvoiceLines, invData.ID, productID, mode)
+			if err != nil {
+				_ = tx.Rollback()
+				exitWith("cek existing invoice item failed: " + err.Error())
+			}
+			if orderDone || invoiceDone {
+				skippedReport.add(r+1, invoiceNumber, productCode, "produk sudah diimport pada tahap sebelumnya")
+				continue
+			}
+		}
+
+		// comma is the thousands separator in this file
+		parsePercent := func(s string) Percent {
+			n, _ := parseDecimal(strings.ReplaceAll(s, ",", ""), 4)
+			return Percent(n)
+		}
+
+		qty, qtyOK := parseItemQty(getCol(3))
+		qtyExtra, qtyExtraOK := parseItemQty(getCol(4))
+		if !qtyOK || !qtyExtraOK {
+			skippedReport.add(r+1, invoiceNumber, productCode, fmt.Sprintf("qty %q / qty extra %q bukan bilangan bulat", getCol(3), getCol(4)))
+			continue
+		}
+		price, _ := parseMoney(strings.ReplaceAll(getCol(5), ",", ""))
+		discR := parsePercent(getCol(6))
+		discP := parsePercent(getCol(7))
+		batch := getCol(9)
+		expDateCell := getCol(10)
+		expDate, batchOK, err := batchValidator.validate(tx, r+1, productCode, productID, batch, &expDateCell)
+		if err != nil {
+			_ = tx.Rollback()
+			exitWith("error validating batch: " + err.Error())
+		}
+		if !batchOK {
+			skippedReport.add(r+1, invoiceNumber, productCode, "batch / expired tidak valid")
+			continue
+		}
+
+		// discounts and dpp are rounded to sen per unit, as the web app does
+		discRVal := price.percent(discR)
+		discPVal := price.percent(discP)
+		discVal := discRVal + discPVal
+		dpp := (price - discVal).mulRatio(invData.Tax.DPPFactor)
+
+		// invoice type 2 keeps a line per batch
+		var invoiceBatch interface{}
+		if invData.TypeInv == 2 {
+			invoiceBatch = batch
+		}
+
+		orderLine, err := findSalesLines(tx, salesOrderLines, orderID, productID, nil, mode.TempIteration)
+		if err != nil {
+			_ = tx.Rollback()
+			exitWith("error querying order item: " + err.Error())
+		}
+		invoiceLine, err := findSalesLines(tx, salesInvoiceLines, invData.ID, productID, invoiceBatch, mode.TempIteration)
+		if err != nil {
+			_ = tx.Rollback()
+			exitWith("error querying invoice item: " + err.Error())
+		}
+		if skipExistingLines(*merge, orderLine, invoiceLine) {
+			skippedReport.add(r+1, invoiceNumber, productCode, "produk sudah ada di order/invoice, dilewati (merge=skip)")
+			continue
+		}
+
+		// order
+		err = applySalesLinePlan(tx, salesOrderLines, orderLine, planSalesLine(orderLine, qty, qtyExtra),
+			func(qty int64) (int64, error) {
+				res, err := stmtOrder.Exec(orderID, productID, price, discVal, discRVal, discPVal, discR, discP, dpp, qty, mode.TempIteration)
+				if err != nil {
+					return 0, err
+				}
+				return res.LastInsertId()
+			},
+			func(qtyExtra, groupID int64) error {
+				_, err := stmtOrderExtra.Exec(orderID, productID, price, discVal, discRVal, discPVal, discR, discP, qtyExtra, groupID, mode.TempIteration)
+				return err
+			})
+		if err != nil {
+			_ = tx.Rollback()
+			exitWith("write order item failed: " + err.Error())
+		}
+
+		// invoice
+		err = applySalesLinePlan(tx, salesInvoiceLines, invoiceLine, planSalesLine(invoiceLine, qty, qtyExtra),
+			func(qty int64) (int64, error) {
+				res, err := stmtInvoice.Exec(
+					invData.ID, productID, invData.Salesman, price, invoiceBatch,
+					discVal, discRVal, discPVal, discR, discP, dpp, qty, mode.TempIteration,
+				)
+				if err != nil {
+					return 0, err
+				}
+				return res.LastInsertId()
+			},
+			func(qtyExtra, groupID int64) error {
+				_, err := stmtInvoiceExtra.Exec(invData.ID, productID, invData.Salesman, price, invoiceBatch, discVal, discRVal, discPVal, discR, discP, qtyExtra, groupID, mode.TempIteration)
+				return err
+			})
+		if err != nil {
+			_ = tx.Rollback()
+			exitWith("write invoice item failed: " + err.Error())
+		}
+
+		// skb
+		if mode.SkipFilledSkb && skbFilled[skbID] {
+			skippedReport.add(r+1, invoiceNumber, productCode, "skb sudah berisi item, item skb tidak ditambah")
+		} else {
+			if _, err := stmtSkb.Exec(skbID, productID, qty, price, batch, expDate, 5, orderID); err != nil {
+				_ = tx.Rollback()
+				exitWith("insert skb item failed: " + err.Error())
+			}
+			if qtyExtra > 0 {
+				if _, err := stmtSkbExtra.Exec(skbID, productID, qtyExtra, price, batch, expDate, 5, orderID); err != nil {
+					_ = tx.Rollback()
+					exitWith("insert skb extra failed: " + err.Error())
+				}
+			}
+		}
+
+		linkKey := fmt.Sprintf("%d_%d", invData.ID, skbID)
+		if !invoiceSKBLinked[linkKey] {
+			if _, err := tx.Exec("INSERT IGNORE INTO rel_sales_invoice_skb (sales_invoice_id, skb_id) VALUES (?, ?)", invData.ID, skbID); err != nil {
+				_ = tx.Rollback()
+				exitWith("insert rel_sales_invoice_skb failed: " + err.Error())
+			}
+			invoiceSKBLinked[linkKey] = true
+		}
+
+		insertedCount++
+		if *batchSize > 0 && insertedCount%*batchSize == 0 {
+			log.Printf("processed %d rows...", insertedCount)
+		}
+	}
+
+	if *reconcile {
+		if _, err := reconcileInvoices(tx, touchedInvoices, stampDutyAmount, *rounding, toleranceAmount, *fixTotals, totalReport); err != nil {
+			_ = tx.Rollback()
+			exitWith("error reconciling invoice total: " + err.Error())
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		exitWith("commit failed: " + err.Error())
+	}
+
+	if err := writeReports(*reportPath, skippedReport, batchValidator.report, totalReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v", *reportPath, err)
+	}
+
+	resp.Success = true
+	resp.Message = "Import Sales Invoice Product Success"
+	resp.MessageDetail = fmt.Sprintf("Mode %s: %d rows imported, %d skipped, %d batch/expiry violations, %d invoice totals not matching. Execution Time: %.4f seconds",
+		*modeName, insertedCount, skippedReport.count(), batchValidator.report.count(), totalReport.count(), time.Since(start).Seconds())
+
+	out, _ := json.Marshal(resp)
+	fmt.Println(string(out))
+	log.Printf("Import done: %d rows, %.4fs", insertedCount, time.Since(start).Seconds())
+}
+
+// salesLineExists reports whether an order/invoice already has a line for
+// the product from a stage before mode.
+func salesLineExists(tx *sql.Tx, t salesLineTable, parentID, productID int64, mode InvoiceItemModeSpec) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT DISTINCT temp_iteration FROM %s WHERE %s = ? AND product_id = ? AND temp_iteration IS NOT NULL",
+		t.Table, t.KeyColumn), parentID, productID)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var iteration int
+		if err := rows.Scan(&iteration); err != nil {
+			return false, err
+		}
+		if mode.importedBefore(iteration) {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// itemQtyPattern accepts a whole number, optionally with comma thousands
+// separators and a zero fraction ("1,250", "3.00").
+var itemQtyPattern = regexp.MustCompile(`^(\d+|\d{1,3}(,\d{3})+)(\.0+)?$`)
+
+// parseItemQty parses a qty cell. An empty cell is 0; a fraction or any
+// other text is not a qty.
+func parseItemQty(s string) (int64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, true
+	}
+	if !itemQtyPattern.MatchString(s) {
+		return 0, false
+	}
+	whole, _, _ := strings.Cut(strings.ReplaceAll(s, ",", ""), ".")
+	n, err := strconv.ParseInt(whole, 10, 64)
+	return n, err == nil
+}
+
+// skipExistingLines reports whether a row is skipped because the stage
+// already wrote the product on the order or the invoice (--merge skip).
+func skipExistingLines(merge string, lines ...*SalesLineData) bool {
+	if merge != InvoiceItemMergeSkip {
+		return false
+	}
+	for _, l := range lines {
+		if l.exists() {
+			return true
+		}
+	}
+	return false
+}
+
+// findSalesLines loads the main line (qty_extra = 0) and the bonus line
+// (qty_extra > 0) of a product written by the given stage. A main line can
+// have qty 0 when the product's first row was bonus-only, so qty does not
+// tell them apart. A nil batch matches any batch.
+func findSalesLines(tx *sql.Tx, t salesLineTable, parentID, productID int64, batch interface{}, iteration int) (*SalesLineData, error) {
+	where := fmt.Sprintf("%s = ? AND product_id = ? AND temp_iteration = ?", t.KeyColumn)
+	args := []interface{}{parentID, productID, iteration}
+	if batch != nil {
+		where += " AND batch_number = ?"
+		args = append(args, batch)
+	}
+
+	line := &SalesLineData{}
+	err := tx.QueryRow(fmt.Sprintf("SELECT rel_id, qty FROM %s WHERE %s AND qty_extra = 0 ORDER BY rel_id LIMIT 1", t.Table, where), args...).
+		Scan(&line.MainID, &line.Qty)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	err = tx.QueryRow(fmt.Sprintf("SELECT rel_id, qty_extra FROM %s WHERE %s AND qty_extra > 0 ORDER BY rel_id LIMIT 1", t.Table, where), args...).
+		Scan(&line.ExtraID, &line.QtyExtra)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return line, nil
+}
+
+// planSalesLine decides how a row lands on the stage's lines of a product:
+// qty goes to the main line, qty_extra to the bonus line grouped under it.
+// A new product gets a main line (also for a bonus-only row) and, with
+// qty_extra, a bonus line. Existing lines are added to; a bonus line that
+// has no main line yet keeps its qty_extra and is regrouped under the main
+// line the row inserts, so the product never gets a second bonus line.
+func planSalesLine(line *SalesLineData, qty, qtyExtra int64) SalesLinePlan {
+	plan := SalesLinePlan{MainQty: line.Qty + qty, ExtraQty: line.QtyExtra + qtyExtra}
+	switch {
+	case !line.exists():
+		plan.InsertMain = true
+		plan.InsertExtra = qtyExtra > 0
+	case line.MainID.Valid:
+		plan.UpdateMain = qty != 0
+		plan.UpdateExtra = qtyExtra > 0 && line.ExtraID.Valid
+		plan.InsertExtra = qtyExtra > 0 && !line.ExtraID.Valid
+	default: // bonus line only
+		plan.InsertMain = qty != 0
+		plan.RegroupExtra = qty != 0
+		plan.UpdateExtra = qtyExtra > 0
+	}
+	return plan
+}
+
+// applySalesLinePlan writes a plan. insertMain inserts a main line with the
+// given qty and returns its rel_id; insertExtra inserts a bonus line with
+// the given qty_extra under groupID.
+func applySalesLinePlan(tx *sql.Tx, t salesLineTable, line *SalesLineData, plan SalesLinePlan,
+	insertMain func(qty int64) (int64, error), insertExtra func(qtyExtra, groupID int64) error) error {
+	groupID := line.MainID.Int64
+	if plan.InsertMain {
+		id, err := insertMain(plan.MainQty)
+		if err != nil {
+			return err
+		}
+		groupID = id
+	}
+	if plan.UpdateMain {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET qty = ? WHERE rel_id = ?", t.Table), plan.MainQty, line.MainID.Int64); err != nil {
+			return err
+		}
+	}
+	if plan.RegroupExtra {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET group_id = ? WHERE rel_id = ?", t.Table), groupID, line.ExtraID.Int64); err != nil {
+			return err
+		}
+	}
+	if plan.UpdateExtra {
+		if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET qty_extra = ? WHERE rel_id = ?", t.Table), plan.ExtraQty, line.ExtraID.Int64); err != nil {
+			return err
+		}
+	}
+	if plan.InsertExtra {
+		return insertExtra(plan.ExtraQty, groupID)
+	}
+	return nil
+}
+
+// Helper structs
+type InvoiceItemModeSpec struct {
+	TempIteration   int    // temp_iteration written on new lines
+	PriorIterations []int  // stages whose lines mean the product is already imported
+	SkipFilledSkb   bool   // leave SKBs that had items before the run alone
+	BatchCheck      string // default --batch-check
+}
+
+// importedBefore reports whether a line written with temp_iteration
+// iteration comes from a stage before this one.
+func (s InvoiceItemModeSpec) importedBefore(iteration int) bool {
+	for _, it := range s.PriorIterations {
+		if it == iteration {
+			return true
+		}
+	}
+	return false
+}
+
+type salesLineTable struct {
+	Table     string
+	KeyColumn string
+}
+
+type SalesInvoiceRef struct {
+	ID       int64
+	Salesman int64
+	TypeInv  int64
+	Tax      TaxRule
+}
+
+type SalesLineData struct {
+	MainID   sql.NullInt64
+	Qty      int64
+	ExtraID  sql.NullInt64
+	QtyExtra int64
+}
+
+// exists reports whether the stage already wrote a main or a bonus line.
+func (l *SalesLineData) exists() bool {
+	return l.MainID.Valid || l.ExtraID.Valid
+}
+
+// SalesLinePlan is what planSalesLine decided for one row.
+type SalesLinePlan struct {
+	InsertMain   bool
+	UpdateMain   bool
+	MainQty      int64 // qty of the inserted or updated main line
+	InsertExtra  bool
+	UpdateExtra  bool
+	RegroupExtra bool  // move the existing bonus line under the new main line
+	ExtraQty     int64 // qty_extra of the inserted or updated bonus line
+}
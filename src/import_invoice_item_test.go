@@ -0,0 +1,139 @@
+package src
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+// The old importers wrote temp_iteration 1 (invoice-product), 2
+// (invoice-outstanding-product) and 3 (invoice-product-missing). Outstanding
+// skipped products with a line of iteration 1, missing those with 1 or 2,
+// and both left SKBs that already had items alone.
+func TestInvoiceItemModes(t *testing.T) {
+	tests := []struct {
+		mode          string
+		tempIteration int
+		skipFilledSkb bool
+		priorLine     map[int]bool // existing temp_iteration -> already imported
+	}{
+		{InvoiceItemModeInitial, 1, false, map[int]bool{1: false, 2: false, 3: false}},
+		{InvoiceItemModeOutstanding, 2, true, map[int]bool{1: true, 2: false, 3: false}},
+		{InvoiceItemModeMissing, 3, true, map[int]bool{1: true, 2: true, 3: false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			spec, ok := invoiceItemModes[tt.mode]
+			if !ok {
+				t.Fatalf("mode %s not defined", tt.mode)
+			}
+			if spec.TempIteration != tt.tempIteration {
+				t.Errorf("TempIteration = %d, want %d", spec.TempIteration, tt.tempIteration)
+			}
+			if spec.SkipFilledSkb != tt.skipFilledSkb {
+				t.Errorf("SkipFilledSkb = %v, want %v", spec.SkipFilledSkb, tt.skipFilledSkb)
+			}
+			for iteration, want := range tt.priorLine {
+				if got := spec.importedBefore(iteration); got != want {
+					t.Errorf("importedBefore(%d) = %v, want %v", iteration, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseItemQty(t *testing.T) {
+	tests := []struct {
+		raw    string
+		want   int64
+		wantOK bool
+	}{
+		{"", 0, true},
+		{"12", 12, true},
+		{"1,250", 1250, true},
+		{"3.00", 3, true},
+		{"2,5", 0, false},
+		{"2.5", 0, false},
+		{"-1", 0, false},
+		{"abc", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseItemQty(tt.raw)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseItemQty(%q) = %d, %v, want %d, %v", tt.raw, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestSkipExistingLines(t *testing.T) {
+	none := &SalesLineData{}
+	main := &SalesLineData{MainID: sql.NullInt64{Int64: 10, Valid: true}, Qty: 5}
+	bonusOnly := &SalesLineData{ExtraID: sql.NullInt64{Int64: 11, Valid: true}, QtyExtra: 2}
+	tests := []struct {
+		name  string
+		merge string
+		lines []*SalesLineData
+		want  bool
+	}{
+		{"add on existing line", InvoiceItemMergeAdd, []*SalesLineData{main, none}, false},
+		{"skip on existing order line", InvoiceItemMergeSkip, []*SalesLineData{main, none}, true},
+		{"skip on existing invoice line", InvoiceItemMergeSkip, []*SalesLineData{none, main}, true},
+		{"skip on bonus-only line", InvoiceItemMergeSkip, []*SalesLineData{bonusOnly, none}, true},
+		{"skip on new product", InvoiceItemMergeSkip, []*SalesLineData{none, none}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := skipExistingLines(tt.merge, tt.lines...); got != tt.want {
+				t.Errorf("skipExistingLines = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanSalesLine(t *testing.T) {
+	main := SalesLineData{MainID: sql.NullInt64{Int64: 10, Valid: true}, Qty: 5}
+	mainBonus := SalesLineData{MainID: sql.NullInt64{Int64: 10, Valid: true}, Qty: 5, ExtraID: sql.NullInt64{Int64: 11, Valid: true}, QtyExtra: 2}
+	bonusOnly := SalesLineData{ExtraID: sql.NullInt64{Int64: 11, Valid: true}, QtyExtra: 2}
+	// what a bonus-only row for a new product leaves behind
+	emptyMainBonus := SalesLineData{MainID: sql.NullInt64{Int64: 10, Valid: true}, ExtraID: sql.NullInt64{Int64: 11, Valid: true}, QtyExtra: 2}
+	tests := []struct {
+		name     string
+		line     SalesLineData
+		qty      int64
+		qtyExtra int64
+		want     SalesLinePlan
+	}{
+		{"new product", SalesLineData{}, 3, 0,
+			SalesLinePlan{InsertMain: true, MainQty: 3}},
+		{"new product with bonus", SalesLineData{}, 3, 1,
+			SalesLinePlan{InsertMain: true, MainQty: 3, InsertExtra: true, ExtraQty: 1}},
+		{"new product, bonus-only row", SalesLineData{}, 0, 2,
+			SalesLinePlan{InsertMain: true, MainQty: 0, InsertExtra: true, ExtraQty: 2}},
+		{"qty row after a bonus-only new product", emptyMainBonus, 4, 0,
+			SalesLinePlan{UpdateMain: true, MainQty: 4, ExtraQty: 2}},
+		{"qty and bonus row after a bonus-only new product", emptyMainBonus, 4, 1,
+			SalesLinePlan{UpdateMain: true, MainQty: 4, UpdateExtra: true, ExtraQty: 3}},
+		{"bonus-only row after a bonus-only new product", emptyMainBonus, 0, 3,
+			SalesLinePlan{MainQty: 0, UpdateExtra: true, ExtraQty: 5}},
+		{"add qty to main line", main, 4, 0,
+			SalesLinePlan{UpdateMain: true, MainQty: 9, ExtraQty: 0}},
+		{"add bonus to main line without bonus", main, 0, 2,
+			SalesLinePlan{MainQty: 5, InsertExtra: true, ExtraQty: 2}},
+		{"add qty and bonus to main and bonus lines", mainBonus, 1, 3,
+			SalesLinePlan{UpdateMain: true, MainQty: 6, UpdateExtra: true, ExtraQty: 5}},
+		{"bonus-only row on bonus-only line", bonusOnly, 0, 3,
+			SalesLinePlan{UpdateExtra: true, ExtraQty: 5}},
+		{"qty row on bonus-only line", bonusOnly, 4, 0,
+			SalesLinePlan{InsertMain: true, MainQty: 4, RegroupExtra: true, ExtraQty: 2}},
+		{"qty and bonus row on bonus-only line", bonusOnly, 4, 1,
+			SalesLinePlan{InsertMain: true, MainQty: 4, RegroupExtra: true, UpdateExtra: true, ExtraQty: 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			line := tt.line
+			if got := planSalesLine(&line, tt.qty, tt.qtyExtra); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planSalesLine = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -20,10 +20,15 @@ func RunImportSalesInvoiceReturnCmd(args []string) {
 	adminID := fs.Int("admin-id", 1, "createdBy admin id")
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	postCredit := fs.String("post-credit", ReturnCreditNone, "book the return value: none, invoice (deduct from the invoice in column 10, rest as deposit) or deposit")
+	tolerance := fs.String("tolerance", "0.01", "amounts at or below this are treated as zero")
+	reportPath := fs.String("report", "", "path to xlsx report of posted return credits (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
 	resp := Response{Success: false}
+	creditReport := newImportReport("Kredit Retur", "Baris", "No Retur", "No Faktur", "Nilai Retur", "Potong Faktur", "Deposit", "Keterangan")
+	pendingCredits := []ReturnCreditPosting{}
 
 	// --- VALIDASI FILE & DSN ---
 	if *dsn == "" {
@@ -31,6 +36,17 @@ func RunImportSalesInvoiceReturnCmd(args []string) {
 		printResp(resp)
 		os.Exit(1)
 	}
+	toleranceAmount, err := parseMoneyFlag("tolerance", *tolerance)
+	if err != nil {
+		resp.Message = err.Error()
+		printResp(resp)
+		os.Exit(1)
+	}
+	if *postCredit != ReturnCreditNone && *postCredit != ReturnCreditInvoice && *postCredit != ReturnCreditDeposit {
+		resp.Message = "post-credit must be none, invoice or deposit"
+		printResp(resp)
+		os.Exit(1)
+	}
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
 		printResp(resp)
@@ -138,8 +154,8 @@ func RunImportSalesInvoiceReturnCmd(args []string) {
 			divisionID = 2
 		}
 
-		cashDiscount := denormFloat(getCol(6))
-		amount := denormFloat(getCol(7))
+		cashDiscount := denormMoney(getCol(6))
+		amount := denormMoney(getCol(7))
 		returnType := strings.TrimSpace(getString(getCol(8)))
 
 		// mapping STB type
@@ -154,6 +170,7 @@ func RunImportSalesInvoiceReturnCmd(args []string) {
 		}
 
 		outletCode := strings.TrimSpace(getString(getCol(9)))
+		salesInvoiceNumber := strings.TrimSpace(getString(getCol(10)))
 
 		// --- cek duplicate return ---
 		var exists int
@@ -223,6 +240,20 @@ func RunImportSalesInvoiceReturnCmd(args []string) {
 		}
 		batchStbRows = append(batchStbRows, stbVals)
 
+		if *postCredit != ReturnCreditNone {
+			credit := ReturnCreditData{
+				ReturnNumber: invoiceNumber,
+				BranchID:     branchID,
+				OutletID:     outletID,
+				OutletCode:   outletCode,
+				Amount:       amount,
+			}
+			if invoiceDate != nil {
+				credit.ReturnDate = invoiceDate.(string)
+			}
+			pendingCredits = append(pendingCredits, ReturnCreditPosting{Row: i + 1, InvoiceNumber: salesInvoiceNumber, Credit: credit})
+		}
+
 		if len(batchReturnRows) >= *batchSize {
 			if err := flushInvoiceReturn(tx, returnCols, batchReturnRows); err != nil {
 				resp.Message = err.Error()
@@ -254,14 +285,25 @@ func RunImportSalesInvoiceReturnCmd(args []string) {
 		inserted += len(batchReturnRows)
 	}
 
+	// --- posting kredit retur ---
+	if err := postReturnCredits(tx, pendingCredits, *postCredit, toleranceAmount, *adminID, creditReport); err != nil {
+		_ = tx.Rollback()
+		resp.Message = "error posting return credit: " + err.Error()
+		goto FINISH
+	}
+
 	if err := tx.Commit(); err != nil {
 		resp.Message = "commit error: " + err.Error()
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, creditReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import Sales Invoice Return Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted. Execution time: %.4fs", inserted, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted, %d return credits processed. Execution time: %.4fs", inserted, creditReport.count(), time.Since(start).Seconds())
 
 FINISH:
 	printResp(resp)
@@ -19,10 +19,15 @@ func RunImportSalesInvoiceReturnProductCmd(args []string) {
 	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	allowUnmatched := fs.Bool("allow-unmatched", true, "insert lines without an original invoice reference or item unvalidated (reported) instead of rejecting them")
+	tolerance := fs.String("tolerance", "0.01", "allowed difference before a price or discount counts as a mismatch")
+	reportPath := fs.String("report", "", "path to xlsx report of rejected lines and price mismatches (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
 	resp := Response{Success: false}
+	validationReport := newImportReport("Validasi Retur", "Baris", "No Retur", "No Faktur", "Kode Produk", "Batch", "Qty Retur", "Sisa Qty", "Keterangan")
+	mismatchReport := newImportReport("Selisih Harga Retur", "Baris", "No Retur", "No Faktur", "Kode Produk", "Batch", "Kolom", "Nilai File", "Nilai Faktur")
 
 	if *dsn == "" {
 		resp.Message = "dsn is required"
@@ -30,6 +35,15 @@ func RunImportSalesInvoiceReturnProductCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	toleranceAmount, err := parseMoneyFlag("tolerance", *tolerance)
+	if err != nil {
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	// the same tolerance applies to discount percentages
+	tolerancePct, _ := parseDecimal(*tolerance, 4)
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
 		out, _ := json.Marshal(resp)
@@ -105,10 +119,22 @@ func RunImportSalesInvoiceReturnProductCmd(args []string) {
 		os.Exit(1)
 	}
 
+	if err := requireColumns(tx, "rel_return_invoice_stb", "0003_return_invoice_stb_source_invoice.sql", "source_sales_invoice_id"); err != nil {
+		_ = tx.Rollback()
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
 	// Caches
 	returnInvoiceCache := make(map[string]*ReturnInvoiceData)
 	stbCache := make(map[string]*STBData)
 	productCache := make(map[string]int64)
+	salesInvoiceCache := make(map[string]int64)
+	// qty already accepted in this run per invoice/product/batch, on top of
+	// the returns stored in the DB
+	returnedInRun := make(map[string]int64)
 
 	// Batch containers
 	cols := []string{
@@ -116,6 +142,7 @@ func RunImportSalesInvoiceReturnProductCmd(args []string) {
 		"quoted_price", "discount_price", "discount_routine_branch", "discount_routine_central",
 		"discount_program_branch", "discount_program_central", "discount_extra", "hna",
 		"total_price", "batch_number", "serial_number", "expired_date", "reference_type_id", "reference_id",
+		"source_sales_invoice_id",
 	}
 	batchRows := [][]interface{}{}
 	insertedCount := 0
@@ -146,6 +173,8 @@ func RunImportSalesInvoiceReturnProductCmd(args []string) {
 		pricePtr := getCol(7)
 		discountRoutinePtr := getCol(8)
 		discountProgramPtr := getCol(9)
+		// original sales invoice (col 11), older files do not have it
+		salesInvoiceNumber := strings.TrimSpace(getString(getCol(11)))
 
 		if invoiceNumberPtr == nil || productCodePtr == nil {
 			fmt.Println("invoice dan product code kosong")
@@ -241,19 +270,98 @@ func RunImportSalesInvoiceReturnProductCmd(args []string) {
 			batchNumber = strings.TrimSpace(*batchNumberPtr)
 		}
 		expiredDate := parseDateForSQL(expiredDatePtr)
-		price := denormFloat(pricePtr)
-		discountRoutine := denormFloat(discountRoutinePtr)
-		discountProgram := denormFloat(discountProgramPtr)
+		price := denormMoney(pricePtr)
+		discountRoutine := denormPercent(discountRoutinePtr)
+		discountProgram := denormPercent(discountProgramPtr)
+
+		// --- match the original invoice line ---
+		var sourceInvoiceID interface{}
+		var source *ReturnSourceLine
+		if salesInvoiceNumber != "" {
+			salesInvoiceID, ok := salesInvoiceCache[salesInvoiceNumber]
+			if !ok {
+				err = tx.QueryRow("SELECT sales_invoice_id FROM list_sales_invoice WHERE sales_invoice_number = ? LIMIT 1", salesInvoiceNumber).Scan(&salesInvoiceID)
+				if err == sql.ErrNoRows {
+					salesInvoiceID = 0
+				} else if err != nil {
+					_ = tx.Rollback()
+					resp.Message = "error querying sales invoice: " + err.Error()
+					goto FINISH
+				}
+				salesInvoiceCache[salesInvoiceNumber] = salesInvoiceID
+			}
+			if salesInvoiceID != 0 {
+				source, err = loadReturnSourceLine(tx, salesInvoiceID, productID, batchNumber)
+				if err != nil {
+					_ = tx.Rollback()
+					resp.Message = "error querying original invoice item: " + err.Error()
+					goto FINISH
+				}
+			}
+		}
+
+		if source == nil {
+			reason := "nomor faktur asal kosong"
+			if salesInvoiceNumber != "" {
+				if salesInvoiceCache[salesInvoiceNumber] == 0 {
+					reason = "faktur asal tidak ditemukan"
+				} else {
+					reason = "produk/batch tidak ada di faktur asal"
+				}
+			}
+			if !*allowUnmatched {
+				validationReport.add(r+1, invoiceNumber, salesInvoiceNumber, productCode, batchNumber, qty+qtyExtra, nil, reason+", ditolak")
+				continue
+			}
+			validationReport.add(r+1, invoiceNumber, salesInvoiceNumber, productCode, batchNumber, qty+qtyExtra, nil, reason+", diimport tanpa validasi")
+		} else {
+			sourceKey := fmt.Sprintf("%d|%d|%s", source.SalesInvoiceID, productID, source.BatchNumber)
+			remaining := source.Sold - source.Returned - returnedInRun[sourceKey]
+			if qty+qtyExtra > remaining {
+				validationReport.add(r+1, invoiceNumber, salesInvoiceNumber, productCode, source.BatchNumber, qty+qtyExtra, remaining, "qty retur melebihi sisa qty faktur, ditolak")
+				continue
+			}
+			returnedInRun[sourceKey] += qty + qtyExtra
+			sourceInvoiceID = source.SalesInvoiceID
+			if batchNumber == "" {
+				batchNumber = source.BatchNumber
+			}
+
+			// harga dan diskon default dari faktur asal
+			if pricePtr == nil {
+				price = source.Price
+			} else if (price - source.Price).abs() > toleranceAmount {
+				mismatchReport.add(r+1, invoiceNumber, salesInvoiceNumber, productCode, batchNumber, "harga", price, source.Price)
+			}
+			checks := []struct {
+				name  string
+				ptr   *string
+				value *Percent
+				orig  Percent
+			}{
+				{"diskon reguler", discountRoutinePtr, &discountRoutine, source.DiscountRoutine},
+				{"diskon program", discountProgramPtr, &discountProgram, source.DiscountProgram},
+			}
+			for _, c := range checks {
+				if c.ptr == nil {
+					*c.value = c.orig
+					continue
+				}
+				if diff := *c.value - c.orig; diff > Percent(tolerancePct) || -diff > Percent(tolerancePct) {
+					mismatchReport.add(r+1, invoiceNumber, salesInvoiceNumber, productCode, batchNumber, c.name, *c.value, c.orig)
+				}
+			}
+		}
 
 		// Calculate values
-		discountRoutineValue := discountRoutine / 100 * price
-		discountProgramValue := discountProgram / 100 * price
+		discountRoutineValue := price.percent(discountRoutine)
+		discountProgramValue := price.percent(discountProgram)
 		discountValue := discountRoutineValue + discountProgramValue
 
 		// Main product entry
 		if qty > 0 {
-			hnaMain := price * float64(qty)
-			discountExtra := price * float64(qtyExtra)
+			hnaMain := price.mulInt(qty)
+			discountExtra := price.mulInt(qtyExtra)
 			totalPriceMain := hnaMain - discountExtra - discountValue
 
 			rowVals := []interface{}{
@@ -277,6 +385,7 @@ func RunImportSalesInvoiceReturnProductCmd(args []string) {
 				expiredDate,                   // expired_date
 				1,                             // reference_type_id
 				nil,                           // reference_id
+				sourceInvoiceID,               // source_sales_invoice_id
 			}
 			batchRows = append(batchRows, rowVals)
 		}
@@ -314,9 +423,14 @@ func RunImportSalesInvoiceReturnProductCmd(args []string) {
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, validationReport, mismatchReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import Sales Invoice Return Product Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted. Execution Time: %.4fs", insertedCount, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted, %d validation notes, %d price mismatches. Execution Time: %.4fs",
+		insertedCount, validationReport.count(), mismatchReport.count(), time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
@@ -324,7 +438,67 @@ FINISH:
 	log.Printf("import sales invoice return product complete: %d rows, time=%.4fs\n", insertedCount, time.Since(start).Seconds())
 }
 
+// loadReturnSourceLine finds what was sold of a product on the original
+// invoice and how much of it was already returned. An empty batch matches
+// the product over all batches; the batch is then taken from the invoice
+// when it holds only one. Price and discounts come from the main line
+// (qty_extra = 0), since bonus lines are stored separately under it.
+func loadReturnSourceLine(tx *sql.Tx, salesInvoiceID, productID int64, batchNumber string) (*ReturnSourceLine, error) {
+	line := &ReturnSourceLine{SalesInvoiceID: salesInvoiceID, BatchNumber: batchNumber}
+	var sold sql.NullInt64
+	var batchCount int
+	var onlyBatch sql.NullString
+	err := tx.QueryRow(`
+		SELECT SUM(qty + qty_extra), COUNT(DISTINCT batch_number), MAX(batch_number)
+		FROM rel_sales_invoice_item
+		WHERE sales_invoice_id = ? AND product_id = ? AND (? = '' OR batch_number = ?)
+	`, salesInvoiceID, productID, batchNumber, batchNumber).Scan(&sold, &batchCount, &onlyBatch)
+	if err != nil {
+		return nil, err
+	}
+	if !sold.Valid {
+		return nil, nil
+	}
+	line.Sold = sold.Int64
+	if batchNumber == "" && batchCount == 1 {
+		line.BatchNumber = onlyBatch.String
+	}
+
+	err = tx.QueryRow(`
+		SELECT quoted_price, discount_routine_branch, discount_program_branch
+		FROM rel_sales_invoice_item
+		WHERE sales_invoice_id = ? AND product_id = ? AND (? = '' OR batch_number = ?) AND qty_extra = 0
+		ORDER BY rel_id
+		LIMIT 1
+	`, salesInvoiceID, productID, batchNumber, batchNumber).Scan(&line.Price, &line.DiscountRoutine, &line.DiscountProgram)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	var returned sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT SUM(qty + qty_extra)
+		FROM rel_return_invoice_stb
+		WHERE source_sales_invoice_id = ? AND product_id = ? AND (? = '' OR batch_number = ?)
+	`, salesInvoiceID, productID, line.BatchNumber, line.BatchNumber).Scan(&returned)
+	if err != nil {
+		return nil, err
+	}
+	line.Returned = returned.Int64
+	return line, nil
+}
+
 // Helper structs
+type ReturnSourceLine struct {
+	SalesInvoiceID  int64
+	BatchNumber     string
+	Sold            int64
+	Returned        int64
+	Price           Money
+	DiscountRoutine Percent
+	DiscountProgram Percent
+}
+
 type ReturnInvoiceData struct {
 	ReturnInvoiceID int64
 }
@@ -30,6 +30,14 @@ func RunImportOutletCmd(args []string) {
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	logID := fs.String("log-id", "", "optional log_id")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	mode := fs.String("mode", ImportModeInsert, "insert|update|upsert; update/upsert match existing outlets by outlet_id or outlet_code")
+	blankClears := fs.Bool("blank-clears", false, "on update, empty cells clear the column instead of keeping the current value")
+	mainAddressType := fs.String("main-address-type", "", "billing|shipping, type of the main sheet address when its type cell (column 29) is empty")
+	historyStatusID := fs.Int("history-status-id", 0, "history_status_id of the app's history status master for updated outlets (required for update/upsert)")
+	reportPath := fs.String("report", "", "path to xlsx report of changed columns, tax identity and address problems (optional)")
+	strict := fs.Bool("strict", false, "reject rows with an invalid NPWP/NIK/NITKU instead of only reporting them")
+	onlyCodes := fs.String("only-codes", "", "only import these outlet codes (comma list or file, one per line)")
+	excludeCodes := fs.String("exclude-codes", "", "skip these outlet codes (comma list or file, one per line)")
 
 	fs.Parse(args)
 
@@ -42,6 +50,31 @@ func RunImportOutletCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	if !validImportMode(*mode) {
+		resp.Message = "invalid mode: " + *mode
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if *mode != ImportModeInsert && *historyStatusID <= 0 {
+		resp.Message = "history-status-id is required for mode " + *mode
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if *mainAddressType != "" && parseOutletAddressType(*mainAddressType) == 0 {
+		resp.Message = "invalid main-address-type: " + *mainAddressType
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	codes, err := newCodeFilter(*onlyCodes, *excludeCodes)
+	if err != nil {
+		resp.Message = "error reading code list: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
 
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
@@ -121,7 +154,12 @@ func RunImportOutletCmd(args []string) {
 	succeedRows := []int{}
 	failedRows := []string{}
 	uniqueSipnap := map[string]bool{}
-	missingOutletList := map[string]bool{}
+	changeReport := newImportReport("Perubahan Outlet", "Kode Outlet", "Kolom", "Lama", "Baru")
+	taxReport := newImportReport("Identitas Pajak", "Baris", "Kode Outlet", "NPWP", "NIK", "NITKU", "Keterangan")
+	addressReport := newImportReport("Alamat Outlet", "Sumber", "Kode Outlet", "Kota", "Keterangan")
+	addresses := []*OutletAddressData{}
+	updatedRows := 0
+	unchangedRows := 0
 
 	// iterate rows starting from row 2 (index 1), as PHP did
 	currentRow := 2
@@ -157,16 +195,11 @@ func RunImportOutletCmd(args []string) {
 		}
 		outletNamePtr := getCol(1)
 		outletCodePtr := getCol(2)
-		if len(missingOutletList) > 0 {
-			// if not in missing list, continue (mirror PHP logic)
-			if outletCodePtr != nil {
-				if _, ok := missingOutletList[*outletCodePtr]; !ok {
-					// skip
-					currentRow++
-					fmt.Println("missing outlet called")
-					continue
-				}
-			}
+		// --only-codes / --exclude-codes
+		if !codes.allows(getString(outletCodePtr)) {
+			currentRow++
+			fmt.Println("outlet dilewati (filter kode)")
+			continue
 		}
 		outletPicPtr := getCol(3)
 		creditLimit := denormalizeNumber(getCol(4))
@@ -236,9 +269,46 @@ func RunImportOutletCmd(args []string) {
 		if getCol(20) != nil && strings.EqualFold(*getCol(20), "AKTIF") {
 			outletStatus = 2
 		}
-		taxDocumentType := "Dokumen dengan NIK"
-		if npwpVal != "" {
-			taxDocumentType = "Dokumen dengan NPWP/NIK tervalidasi"
+
+		// NPWP/NIK/NITKU format check
+		taxID := checkTaxIdentity(npwpVal, nik, nitku, isPkp == 1)
+		if len(taxID.Violations) > 0 {
+			code := ""
+			if outletCodePtr != nil {
+				code = *outletCodePtr
+			}
+			taxReport.add(currentRow, code, npwpVal, nik, nitku, strings.Join(taxID.Violations, "; "))
+			if *strict {
+				failedRows = append(failedRows, fmt.Sprintf("<b>[<span style='color: orange;'>%d</span> Identitas Pajak]</b>", currentRow))
+				currentRow++
+				continue
+			}
+		}
+		npwpVal = taxID.NPWP
+		nik = taxID.NIK
+		nitku = taxID.NITKU
+
+		// the document type follows the presence of an NPWP; an invalid one
+		// is reported above, not silently downgraded
+		taxDocumentType := outletTaxDocumentType(npwpVal)
+
+		// existing outlet for update/upsert
+		existingID := int64(0)
+		if *mode != ImportModeInsert {
+			existingID, err = findExistingOutletID(tx, outletIDPtr, outletCodePtr)
+			if err != nil {
+				_ = tx.Rollback()
+				resp.Message = "db error finding outlet: " + err.Error()
+				resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
+				out, _ := json.Marshal(resp)
+				fmt.Println(string(out))
+				os.Exit(1)
+			}
+			if existingID == 0 && *mode == ImportModeUpdate {
+				failedRows = append(failedRows, fmt.Sprintf("<b>[<span style='color: orange;'>%d</span> Outlet tidak ditemukan]</b>", currentRow))
+				currentRow++
+				continue
+			}
 		}
 
 		// duplicate sipnap check
@@ -248,7 +318,13 @@ func RunImportOutletCmd(args []string) {
 				currentRow++
 				continue
 			}
-			dup, err := checkDuplicate(tx, "list_outlet", "sipnap_code", sipnapCode)
+			var dup bool
+			if existingID > 0 {
+				// an outlet keeps its own sipnap code on update
+				dup, err = sipnapUsedByOtherOutlet(tx, sipnapCode, existingID)
+			} else {
+				dup, err = checkDuplicate(tx, "list_outlet", "sipnap_code", sipnapCode)
+			}
 			if err != nil {
 				_ = tx.Rollback()
 				resp.Message = "db error checking duplicate: " + err.Error()
@@ -356,11 +432,46 @@ func RunImportOutletCmd(args []string) {
 			*adminID,
 		)
 
+		// alamat utama (columns 21-27, type in 28), saved after the outlets are inserted
+		if addr := readOutletAddress(getCol, 21); addr != nil {
+			addr.Source = fmt.Sprintf("%s baris %d", sheet, currentRow)
+			addr.OutletCode = outletCode
+			addr.TypeID = parseOutletAddressType(getString(getCol(28)))
+			if addr.TypeID == 0 {
+				addr.TypeID = parseOutletAddressType(*mainAddressType)
+			}
+			addresses = append(addresses, addr)
+		}
+
+		if existingID > 0 {
+			blank := map[string]bool{}
+			for col, idx := range outletColumnCells {
+				blank[col] = getCol(idx) == nil
+			}
+			changed, err := updateExistingOutlet(tx, existingID, batchOutletCols, rowVals, blank, *blankClears, *historyStatusID, *adminID, changeReport)
+			if err != nil {
+				_ = tx.Rollback()
+				resp.Message = "error updating list_outlet: " + err.Error()
+				resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
+				out, _ := json.Marshal(resp)
+				fmt.Println(string(out))
+				os.Exit(1)
+			}
+			if changed {
+				updatedRows++
+				fmt.Println("Update row: ", currentRow)
+			} else {
+				unchangedRows++
+			}
+			currentRow++
+			continue
+		}
+
 		batchOutletRows = append(batchOutletRows, rowVals)
 
 		// Prepare history row (same columns + history_status_id)
 		hrow := append([]interface{}{}, rowVals...)
-		hrow = append(hrow, 2) // history_status_id
+		hrow = append(hrow, OutletHistoryStatusCreated)
 		batchHistoryRows = append(batchHistoryRows, hrow)
 
 		// if reached batch size -> flush
@@ -424,6 +535,50 @@ func RunImportOutletCmd(args []string) {
 		}
 	}
 
+	// ---- Sheet: Alamat Outlet (optional, extra addresses per type) ----
+	if idx, _ := f.GetSheetIndex(OutletAddressSheet); idx >= 0 && sheet != OutletAddressSheet {
+		addrRows, err := f.GetRows(OutletAddressSheet)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error reading sheet rows: " + err.Error()
+			resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
+			out, _ := json.Marshal(resp)
+			fmt.Println(string(out))
+			os.Exit(1)
+		}
+		for r := 1; r < len(addrRows); r++ {
+			cols := addrRows[r]
+			getCol := func(idx int) *string {
+				if idx < len(cols) {
+					return checkIsTrueEmpty(cols[idx])
+				}
+				return nil
+			}
+			code := getString(getCol(0))
+			if code == "" || !codes.allows(code) {
+				continue
+			}
+			addr := readOutletAddress(getCol, 2)
+			if addr == nil {
+				continue
+			}
+			addr.Source = fmt.Sprintf("%s baris %d", OutletAddressSheet, r+1)
+			addr.OutletCode = code
+			addr.TypeID = parseOutletAddressType(getString(getCol(1)))
+			addresses = append(addresses, addr)
+		}
+	}
+
+	savedAddresses, err := importOutletAddresses(tx, addresses, &townResolver{}, *blankClears, *adminID, addressReport)
+	if err != nil {
+		_ = tx.Rollback()
+		resp.Message = "error inserting list_outlet_address: " + err.Error()
+		resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
 	// commit transaction
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
@@ -444,9 +599,22 @@ func RunImportOutletCmd(args []string) {
 		}
 	}
 
+	if err := writeReports(*reportPath, changeReport, taxReport, addressReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	// prepare response message_detail
 	messageDetail := fmt.Sprintf("<p>- Total <b>%d</b> baris data berhasil disimpan</p>", len(succeedRows))
+	if *mode != ImportModeInsert {
+		messageDetail += fmt.Sprintf("<p>- Total <b>%d</b> outlet diperbarui (%d kolom berubah), <b>%d</b> tanpa perubahan</p>", updatedRows, changeReport.count(), unchangedRows)
+	}
 	messageDetail += fmt.Sprintf("<p>- Total <b>%d</b> baris duplikat data gagal disimpan</p>", len(failedRows))
+	if len(addresses) > 0 {
+		messageDetail += fmt.Sprintf("<p>- Total <b>%d</b> alamat outlet disimpan, <b>%d</b> catatan alamat</p>", savedAddresses, addressReport.count())
+	}
+	if taxReport.count() > 0 {
+		messageDetail += fmt.Sprintf("<p>- Total <b>%d</b> baris dengan NPWP/NIK/NITKU tidak valid</p>", taxReport.count())
+	}
 	if len(failedRows) > 0 {
 		messageDetail += "<div class='gs-grid-container column-2 scrollable-y' style='max-height: 250px;'>"
 		for _, v := range failedRows {
@@ -465,3 +633,145 @@ func RunImportOutletCmd(args []string) {
 	fmt.Println(string(out))
 	log.Printf("import complete: %d rows succeeded, %d duplicates, time=%.4fs\n", len(succeedRows), len(failedRows), end.Sub(start).Seconds())
 }
+
+// list_outlet_history.history_status_id of a new outlet, as the PHP import
+// wrote it. The status of an update comes from --history-status-id.
+const OutletHistoryStatusCreated = 2
+
+// outletColumnCells maps the list_outlet columns that can be updated to
+// their cell index in the outlet sheet.
+var outletColumnCells = map[string]int{
+	"outlet_name": 1, "outlet_code": 2, "outlet_pic": 3, "credit_limit": 4,
+	"top_lock": 5, "top_value": 6, "lock_discount": 7, "lock_cash_discount": 8,
+	"minimum_invoice_value": 9, "sipnap_code": 10, "branch_id": 11, "segment_internal_id": 12,
+	"npwp": 13, "pkp": 14, "pbf_code": 15, "outlet_type_id": 16, "nik": 17,
+	"nitku": 18, "outlet_note": 19, "outlet_status_id": 20,
+}
+
+// outletDerivedColumns are not read from a cell but derived from the value
+// another column ends up with (see deriveOutletColumns).
+var outletDerivedColumns = []string{"tax_document_type", "is_pkp", "is_pbf"}
+
+// outletTaxDocumentType picks the document type from the presence of an NPWP.
+func outletTaxDocumentType(npwp string) string {
+	if npwp != "" {
+		return "Dokumen dengan NPWP/NIK tervalidasi"
+	}
+	return "Dokumen dengan NIK"
+}
+
+// deriveOutletColumns recomputes the derived columns from the value each
+// source column will have after the update: the incoming value, or the
+// current one when its cell is blank and blankClears is off.
+func deriveOutletColumns(current map[string]string, incoming map[string]interface{}, blank map[string]bool, blankClears bool) {
+	effective := func(col string) string {
+		if blank[col] {
+			if blankClears {
+				return ""
+			}
+			return current[col]
+		}
+		return formatDBValue(incoming[col])
+	}
+	present := func(v string) int {
+		if v != "" {
+			return 1
+		}
+		return 0
+	}
+	incoming["tax_document_type"] = outletTaxDocumentType(effective("npwp"))
+	incoming["is_pkp"] = present(effective("pkp"))
+	incoming["is_pbf"] = present(effective("pbf_code"))
+}
+
+// findExistingOutletID matches an outlet row by outlet_id first, then by
+// outlet_code. It returns 0 when neither matches.
+func findExistingOutletID(tx *sql.Tx, outletID *int, outletCode *string) (int64, error) {
+	var id int64
+	if outletID != nil && *outletID > 0 {
+		err := tx.QueryRow("SELECT outlet_id FROM list_outlet WHERE outlet_id = ? LIMIT 1", *outletID).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+	if outletCode != nil && *outletCode != "" {
+		err := tx.QueryRow("SELECT outlet_id FROM list_outlet WHERE outlet_code = ? LIMIT 1", *outletCode).Scan(&id)
+		if err == nil {
+			return id, nil
+		}
+		if err != sql.ErrNoRows {
+			return 0, err
+		}
+	}
+	return 0, nil
+}
+
+func sipnapUsedByOtherOutlet(tx *sql.Tx, sipnapCode string, outletID int64) (bool, error) {
+	var dummy int
+	err := tx.QueryRow("SELECT 1 FROM list_outlet WHERE sipnap_code = ? AND outlet_id <> ? LIMIT 1", sipnapCode, outletID).Scan(&dummy)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// updateExistingOutlet updates the changed columns of one outlet and, when
+// anything changed, snapshots the updated row into list_outlet_history.
+func updateExistingOutlet(tx *sql.Tx, outletID int64, colsList []string, rowVals []interface{}, blank map[string]bool, blankClears bool, historyStatusID int, adminID int, report *importReport) (bool, error) {
+	derived := map[string]bool{}
+	for _, col := range outletDerivedColumns {
+		derived[col] = true
+	}
+	incoming := map[string]interface{}{}
+	updCols := []string{}
+	for i, col := range colsList {
+		if _, ok := outletColumnCells[col]; !ok && !derived[col] {
+			continue
+		}
+		incoming[col] = rowVals[i]
+		updCols = append(updCols, col)
+	}
+
+	current, err := fetchRowValues(tx, "list_outlet", "outlet_id", outletID, append(updCols, "outlet_code"))
+	if err != nil {
+		return false, err
+	}
+	if current == nil {
+		return false, fmt.Errorf("outlet %d not found", outletID)
+	}
+
+	deriveOutletColumns(current, incoming, blank, blankClears)
+	changes := diffRowValues(current, incoming, updCols, blank, blankClears)
+	if len(changes) == 0 {
+		return false, nil
+	}
+	if err := applyRowUpdate(tx, "list_outlet", "outlet_id", outletID, changes); err != nil {
+		return false, err
+	}
+
+	// history columns are the outlet columns plus createdAt/createdBy of the change
+	histCols := []string{}
+	for _, col := range colsList {
+		if col == "createdAt" || col == "createdBy" {
+			continue
+		}
+		histCols = append(histCols, col)
+	}
+	q := fmt.Sprintf("INSERT INTO `list_outlet_history` (`%s`, `createdAt`, `createdBy`, `history_status_id`) SELECT `%s`, ?, ?, ? FROM `list_outlet` WHERE outlet_id = ?",
+		strings.Join(histCols, "`, `"), strings.Join(histCols, "`, `"))
+	createdAt := time.Now().Format("2006-01-02 15:04:05")
+	if _, err := tx.Exec(q, createdAt, adminID, historyStatusID, outletID); err != nil {
+		return false, fmt.Errorf("error inserting list_outlet_history: %w", err)
+	}
+
+	for _, ch := range changes {
+		report.add(current["outlet_code"], ch.Column, ch.Old, ch.New)
+	}
+	return true, nil
+}
@@ -22,6 +22,12 @@ func RunImportProductCmd(args []string) {
 	adminID := fs.Int("admin-id", 1, "createdBy admin id")
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	logID := fs.String("log-id", "", "optional log_id")
+	mode := fs.String("mode", ImportModeInsert, "insert|update|upsert; update/upsert change existing products by product_code")
+	blankClears := fs.Bool("blank-clears", false, "on update, empty cells clear the column instead of keeping the current value")
+	replaceRelations := fs.Bool("replace-relations", false, "on update, delete substance/supplier/group/license rows of a listed product that are not in the sheet")
+	reportPath := fs.String("report", "", "path to xlsx report of changed columns and relations (optional)")
+	onlyCodes := fs.String("only-codes", "", "only import these product codes (comma list or file, one per line)")
+	excludeCodes := fs.String("exclude-codes", "", "skip these product codes (comma list or file, one per line)")
 
 	fs.Parse(args)
 
@@ -34,6 +40,19 @@ func RunImportProductCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	if !validImportMode(*mode) {
+		resp.Message = "invalid mode: " + *mode
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	codes, err := newCodeFilter(*onlyCodes, *excludeCodes)
+	if err != nil {
+		resp.Message = "error reading code list: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
 
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
@@ -70,9 +89,17 @@ func RunImportProductCmd(args []string) {
 	}
 
 	messageDetailBuilder := strings.Builder{}
+	opts := &productImportOptions{
+		Mode:        *mode,
+		BlankClears: *blankClears,
+		Replace:     *replaceRelations,
+		Changes:     newImportReport("Perubahan Produk", "Kode Produk", "Kolom", "Lama", "Baru"),
+		Relations:   newImportReport("Perubahan Relasi", "Kode Produk", "Sheet", "Aksi", "Nilai"),
+		Codes:       codes,
+	}
 
 	// ---- Sheet: Daftar Produk ----
-	if err := importDaftarProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder); err != nil {
+	if err := importDaftarProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder, opts); err != nil {
 		_ = tx.Rollback()
 		resp.Message = "error importing Daftar Produk: " + err.Error()
 		resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
@@ -82,7 +109,7 @@ func RunImportProductCmd(args []string) {
 	}
 
 	// ---- Sheet: Zat Aktif Produk ----
-	if err := importZatAktifProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder); err != nil {
+	if err := importZatAktifProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder, opts); err != nil {
 		_ = tx.Rollback()
 		resp.Message = "error importing Zat Aktif Produk: " + err.Error()
 		resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
@@ -92,7 +119,7 @@ func RunImportProductCmd(args []string) {
 	}
 
 	// ---- Sheet: Supplier Produk ----
-	if err := importSupplierProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder); err != nil {
+	if err := importSupplierProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder, opts); err != nil {
 		_ = tx.Rollback()
 		resp.Message = "error importing Supplier Produk: " + err.Error()
 		resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
@@ -102,7 +129,7 @@ func RunImportProductCmd(args []string) {
 	}
 
 	// ---- Sheet: Grup Produk ----
-	if err := importGrupProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder); err != nil {
+	if err := importGrupProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder, opts); err != nil {
 		_ = tx.Rollback()
 		resp.Message = "error importing Grup Produk: " + err.Error()
 		resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
@@ -112,7 +139,7 @@ func RunImportProductCmd(args []string) {
 	}
 
 	// ---- Sheet: Izin Produk ----
-	if err := importIzinProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder); err != nil {
+	if err := importIzinProduk(f, tx, *batchSize, *adminID, &messageDetailBuilder, opts); err != nil {
 		_ = tx.Rollback()
 		resp.Message = "error importing Izin Produk: " + err.Error()
 		resp.MessageDetail = fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds())
@@ -140,6 +167,13 @@ func RunImportProductCmd(args []string) {
 		}
 	}
 
+	if err := writeReports(*reportPath, opts.Changes, opts.Relations); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
+	if opts.reconcile() {
+		messageDetailBuilder.WriteString(fmt.Sprintf("- %s, %s ", opts.Changes.summary(), opts.Relations.summary()))
+	}
 	messageDetailBuilder.WriteString(fmt.Sprintf("Execution Time : %.4f seconds", time.Since(start).Seconds()))
 	resp.Success = true
 	resp.Message = "Import Product Success"
@@ -152,7 +186,7 @@ func RunImportProductCmd(args []string) {
 
 // ---------------- Sheet handlers ----------------
 
-func importDaftarProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder) error {
+func importDaftarProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder, opts *productImportOptions) error {
 	sheet := "Daftar Produk"
 	rows, err := f.Rows(sheet)
 	if err != nil {
@@ -182,6 +216,9 @@ func importDaftarProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int
 	rowIndex := 0
 	uniqueName := map[string]bool{}
 	uniqueCode := map[string]bool{}
+	updated := 0
+	unchanged := 0
+	notFound := 0
 
 	for rows.Next() {
 		rowIndex++
@@ -236,18 +273,27 @@ func importDaftarProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int
 		if p := getCol(3); p != nil {
 			productCodeStr = *p
 		}
+		if !opts.Codes.allows(productCodeStr) {
+			continue
+		}
 		// duplicate code check (query)
 		dupName, err := checkDuplicate(tx, "list_product", "product_code", productCodeStr)
 		if err != nil {
 			fmt.Println("error duplicate")
 			return err
 		}
-		if (productCodeStr != "" && uniqueName[productCodeStr]) || dupName {
+		if (productCodeStr != "" && uniqueName[productCodeStr]) || (dupName && opts.Mode == ImportModeInsert) {
 			failed++
 			fmt.Println("Duplicate code: ", productCodeStr)
 			md.WriteString(fmt.Sprintf(" [%d Duplikat Code]", currentRow))
 			continue
 		}
+		if !dupName && opts.Mode == ImportModeUpdate {
+			notFound++
+			fmt.Println("product code tidak ditemukan: ", productCodeStr)
+			md.WriteString(fmt.Sprintf(" [%d Produk tidak ditemukan]", currentRow))
+			continue
+		}
 		uniqueName[productCodeStr] = true
 
 		// product_id is int from product_code in PHP
@@ -480,7 +526,7 @@ func importDaftarProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int
 		}
 
 		// duplicate code check
-		if productCodeStr != "" {
+		if productCodeStr != "" && !dupName {
 			dupCode, err := checkDuplicate(tx, "list_product", "product_code", productCodeStr)
 			if err != nil {
 				return err
@@ -598,6 +644,23 @@ func importDaftarProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int
 			adminID,
 		)
 
+		if dupName {
+			blank := map[string]bool{}
+			for col, idx := range productColumnCells {
+				blank[col] = getCol(idx) == nil
+			}
+			changed, err := updateExistingProduct(tx, productCodeStr, colsList, rowVals, blank, opts)
+			if err != nil {
+				return fmt.Errorf("error updating product %s: %w", productCodeStr, err)
+			}
+			if changed {
+				updated++
+			} else {
+				unchanged++
+			}
+			continue
+		}
+
 		batchRows = append(batchRows, rowVals)
 		succeed++
 
@@ -624,10 +687,61 @@ func importDaftarProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int
 	md.WriteString("Import worksheet Daftar Produk berhasil :")
 	md.WriteString(fmt.Sprintf("- Total %d baris data berhasil disimpan", succeed))
 	md.WriteString(fmt.Sprintf("- Total %d baris duplikat data gagal disimpan", failed))
+	if opts.reconcile() {
+		md.WriteString(fmt.Sprintf("- Total %d produk diperbarui, %d tanpa perubahan, %d tidak ditemukan", updated, unchanged, notFound))
+	}
 	return nil
 }
 
-func importZatAktifProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder) error {
+// productColumnCells maps the list_product columns that can be updated to
+// their cell index in the Daftar Produk sheet.
+var productColumnCells = map[string]int{
+	"product_name": 0, "product_alias": 1, "product_brand": 2, "product_status_id": 43,
+	"principal_id": 4, "principal_division_id": 5, "finished_drug_code": 6, "old_code": 7,
+	"catalogue_code": 8, "product_code_principal": 9, "classification_id": 10, "product_class": 11,
+	"division_id": 12, "packaging": 13, "size": 14, "temperature_requirement": 15,
+	"expired_threshold": 16, "length": 17, "length_unit": 18, "width": 19,
+	"width_unit": 20, "height": 21, "height_unit": 22, "weight": 23,
+	"weight_unit": 24, "volume": 25, "volume_unit": 26, "biggest_conv": 27,
+	"biggest_unit": 28, "smallest_conv": 29, "smallest_unit": 30, "sale_unit": 31,
+	"manufacturer": 32, "default_margin_principal": 33, "lock_discount": 34, "lock_sale": 35,
+	"stock_level_product": 36, "form_id": 37, "remark": 38, "is_need_expired": 39,
+	"required_serial_number": 40, "product_het": 41, "default_hna": 42,
+}
+
+// updateExistingProduct compares the parsed row with the stored product and
+// updates only the columns that differ. Every changed column is written to
+// the change report.
+func updateExistingProduct(tx *sql.Tx, productCode string, colsList []string, rowVals []interface{}, blank map[string]bool, opts *productImportOptions) (bool, error) {
+	incoming := map[string]interface{}{}
+	updCols := []string{}
+	for i, col := range colsList {
+		if _, ok := productColumnCells[col]; !ok {
+			continue
+		}
+		incoming[col] = rowVals[i]
+		updCols = append(updCols, col)
+	}
+
+	current, err := fetchRowValues(tx, "list_product", "product_code", productCode, updCols)
+	if err != nil {
+		return false, err
+	}
+	if current == nil {
+		return false, fmt.Errorf("product %s not found", productCode)
+	}
+
+	changes := diffRowValues(current, incoming, updCols, blank, opts.BlankClears)
+	if err := applyRowUpdate(tx, "list_product", "product_code", productCode, changes); err != nil {
+		return false, err
+	}
+	for _, ch := range changes {
+		opts.Changes.add(productCode, ch.Column, ch.Old, ch.New)
+	}
+	return len(changes) > 0, nil
+}
+
+func importZatAktifProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder, opts *productImportOptions) error {
 	sheet := "Zat Aktif Produk"
 	rows, err := f.Rows(sheet)
 	if err != nil {
@@ -636,6 +750,7 @@ func importZatAktifProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID i
 	defer rows.Close()
 
 	colsList := []string{"product_id", "substance_id", "createdAt", "createdBy"}
+	rel := newProductRelationSet(sheet, "rel_product_substance", "substance_id", colsList)
 	batchRows := [][]interface{}{}
 	succeed := 0
 	// currentRow := 0
@@ -669,6 +784,9 @@ func importZatAktifProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID i
 		if p := getCol(0); p != nil {
 			productCode = *p
 		}
+		if !opts.Codes.allows(productCode) {
+			continue
+		}
 		// get product_id by name
 		row := tx.QueryRow("SELECT product_id FROM list_product WHERE product_code = ? LIMIT 1", productCode)
 		var productID int64
@@ -705,6 +823,11 @@ func importZatAktifProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID i
 				subID = sql.NullInt64{Int64: newID}
 			}
 			createdAt := time.Now().Format("2006-01-02 15:04:05")
+			if opts.reconcile() {
+				rel.add(productID, productCode, strconv.FormatInt(subID.Int64, 10), sub, []interface{}{productID, subID.Int64, createdAt, adminID})
+				succeed++
+				continue
+			}
 			batchRows = append(batchRows, []interface{}{productID, subID.Int64, createdAt, adminID})
 			succeed++
 			if len(batchRows) >= batchSize {
@@ -727,12 +850,16 @@ func importZatAktifProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID i
 		fmt.Println("Sukses insert zat aktif")
 	}
 
+	if err := reconcileProductSheet(tx, rel, opts, md); err != nil {
+		return err
+	}
+
 	md.WriteString("Import worksheet Zat Aktif Produk berhasil :")
 	md.WriteString(fmt.Sprintf("- Total %d baris data berhasil disimpan", succeed))
 	return nil
 }
 
-func importSupplierProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder) error {
+func importSupplierProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder, opts *productImportOptions) error {
 	sheet := "Supplier Produk"
 	rows, err := f.Rows(sheet)
 	if err != nil {
@@ -741,6 +868,7 @@ func importSupplierProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID i
 	defer rows.Close()
 
 	colsList := []string{"product_id", "supplier_id", "flag_id", "createdAt", "createdBy"}
+	rel := newProductRelationSet(sheet, "rel_product_supplier", "supplier_id", colsList, "flag_id")
 	batchRows := [][]interface{}{}
 	succeed := 0
 	rowIndex := 0
@@ -771,6 +899,9 @@ func importSupplierProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID i
 		if p := getCol(0); p != nil {
 			productCode = *p
 		}
+		if !opts.Codes.allows(productCode) {
+			continue
+		}
 		// find product by code
 		row := tx.QueryRow("SELECT product_id FROM list_product WHERE product_code = ? LIMIT 1", productCode)
 		var productID int64
@@ -800,6 +931,11 @@ func importSupplierProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID i
 			flagID = 2
 		}
 		createdAt := time.Now().Format("2006-01-02 15:04:05")
+		if opts.reconcile() {
+			rel.add(productID, productCode, strconv.FormatInt(supplierID, 10), supplierName, []interface{}{productID, supplierID, flagID, createdAt, adminID})
+			succeed++
+			continue
+		}
 		batchRows = append(batchRows, []interface{}{productID, supplierID, flagID, createdAt, adminID})
 		succeed++
 		if len(batchRows) >= batchSize {
@@ -821,12 +957,16 @@ func importSupplierProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID i
 		fmt.Println("Sukses insert supplier product")
 	}
 
+	if err := reconcileProductSheet(tx, rel, opts, md); err != nil {
+		return err
+	}
+
 	md.WriteString("Import worksheet Supplier Produk berhasil :")
 	md.WriteString(fmt.Sprintf("- Total %d baris data berhasil disimpan", succeed))
 	return nil
 }
 
-func importGrupProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder) error {
+func importGrupProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder, opts *productImportOptions) error {
 	sheet := "Grup Produk"
 	rows, err := f.Rows(sheet)
 	if err != nil {
@@ -835,6 +975,7 @@ func importGrupProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int,
 	defer rows.Close()
 
 	colsList := []string{"product_id", "tag_id", "assigned_date", "createdBy"}
+	rel := newProductRelationSet(sheet, "rel_product_tag", "tag_id", colsList)
 	batchRows := [][]interface{}{}
 	succeed := 0
 	rowIndex := 0
@@ -864,6 +1005,9 @@ func importGrupProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int,
 		if p := getCol(0); p != nil {
 			productCode = *p
 		}
+		if !opts.Codes.allows(productCode) {
+			continue
+		}
 		row := tx.QueryRow("SELECT product_id FROM list_product WHERE product_code = ? LIMIT 1", productCode)
 		var productID int64
 		if err := row.Scan(&productID); err != nil {
@@ -893,6 +1037,11 @@ func importGrupProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int,
 			tagID = newID
 		}
 		assignedDate := time.Now().Format("2006-01-02 15:04:05")
+		if opts.reconcile() {
+			rel.add(productID, productCode, strconv.FormatInt(tagID, 10), groupProduct, []interface{}{productID, tagID, assignedDate, adminID})
+			succeed++
+			continue
+		}
 		batchRows = append(batchRows, []interface{}{productID, tagID, assignedDate, adminID})
 		succeed++
 		if len(batchRows) >= batchSize {
@@ -914,12 +1063,16 @@ func importGrupProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int,
 		fmt.Println("Sukses insert grup product")
 	}
 
+	if err := reconcileProductSheet(tx, rel, opts, md); err != nil {
+		return err
+	}
+
 	md.WriteString("Import worksheet Grup Produk berhasil :")
 	md.WriteString(fmt.Sprintf("- Total %d baris data berhasil disimpan", succeed))
 	return nil
 }
 
-func importIzinProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder) error {
+func importIzinProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int, md *strings.Builder, opts *productImportOptions) error {
 	sheet := "Izin Produk"
 	rows, err := f.Rows(sheet)
 	if err != nil {
@@ -928,6 +1081,7 @@ func importIzinProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int,
 	defer rows.Close()
 
 	colsList := []string{"license_type_id", "license_name", "license_number", "effective_date", "expired_date", "createdAt", "createdBy", "product_id", "license_status_id"}
+	rel := newProductRelationSet(sheet, "list_license", "license_number", colsList, "license_name", "effective_date", "expired_date")
 	batchRows := [][]interface{}{}
 	succeed := 0
 	rowIndex := 0
@@ -958,12 +1112,16 @@ func importIzinProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int,
 			productName = *p
 		}
 		// get product id
-		row := tx.QueryRow("SELECT product_id FROM list_product WHERE product_name = ? LIMIT 1", productName)
+		row := tx.QueryRow("SELECT product_id, product_code FROM list_product WHERE product_name = ? LIMIT 1", productName)
 		var productID int64
-		if err := row.Scan(&productID); err != nil {
+		var productCode sql.NullString
+		if err := row.Scan(&productID, &productCode); err != nil {
 			fmt.Println("code di product gak ada", productName)
 			continue
 		}
+		if !opts.Codes.allows(productCode.String) {
+			continue
+		}
 		licenseType := 3
 		licenseName := ""
 		if p := getCol(2); p != nil {
@@ -984,6 +1142,11 @@ func importIzinProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int,
 
 		createdAt := time.Now().Format("2006-01-02 15:04:05")
 		licenseStatus := 1
+		if opts.reconcile() {
+			rel.add(productID, productCode.String, licenseNumber, licenseNumber, []interface{}{licenseType, licenseName, licenseNumber, effectiveDate, expiredDate, createdAt, adminID, productID, licenseStatus})
+			succeed++
+			continue
+		}
 		batchRows = append(batchRows, []interface{}{licenseType, licenseName, licenseNumber, effectiveDate, expiredDate, createdAt, adminID, productID, licenseStatus})
 		succeed++
 		if len(batchRows) >= batchSize {
@@ -1006,7 +1169,179 @@ func importIzinProduk(f *excelize.File, tx *sql.Tx, batchSize int, adminID int,
 		fmt.Println("Sukses insert izin product")
 	}
 
+	if err := reconcileProductSheet(tx, rel, opts, md); err != nil {
+		return err
+	}
+
 	md.WriteString("Import worksheet Izin Produk berhasil :")
 	md.WriteString(fmt.Sprintf("- Total %d baris data berhasil disimpan", succeed))
 	return nil
 }
+
+// reconcileProductSheet applies a sub-sheet's relation set when running in
+// update/upsert mode.
+func reconcileProductSheet(tx *sql.Tx, rel *productRelationSet, opts *productImportOptions, md *strings.Builder) error {
+	if !opts.reconcile() {
+		return nil
+	}
+	added, removed, err := rel.reconcile(tx, opts.Replace, opts.Relations)
+	if err != nil {
+		return fmt.Errorf("error reconciling %s: %w", rel.table, err)
+	}
+	md.WriteString(fmt.Sprintf("- Total %d relasi ditambah, %d relasi dihapus ", added, removed))
+	return nil
+}
+
+// Helper structs
+
+// productImportOptions carries the --mode flags into the sheet handlers.
+type productImportOptions struct {
+	Mode        string
+	BlankClears bool
+	Replace     bool // sub-sheets delete relations they do not list
+	Changes     *importReport
+	Relations   *importReport
+	Codes       *codeFilter
+}
+
+// reconcile reports whether sub-sheets are merged into the existing product
+// relations (see Replace) instead of being appended blindly.
+func (o *productImportOptions) reconcile() bool {
+	return o.Mode != ImportModeInsert
+}
+
+// productRelationSet collects the wanted rows of one product relation table
+// (substance, supplier, tag, license) per product, keyed by keyCol.
+type productRelationSet struct {
+	sheet      string
+	table      string
+	keyCol     string
+	cols       []string
+	updateCols []string // refreshed on rows that already exist
+	order      []int64
+	codes      map[int64]string
+	keys       map[int64][]string
+	rows       map[int64]map[string][]interface{}
+	labels     map[string]string
+}
+
+func newProductRelationSet(sheet, table, keyCol string, cols []string, updateCols ...string) *productRelationSet {
+	return &productRelationSet{
+		sheet:      sheet,
+		table:      table,
+		keyCol:     keyCol,
+		cols:       cols,
+		updateCols: updateCols,
+		codes:      map[int64]string{},
+		keys:       map[int64][]string{},
+		rows:       map[int64]map[string][]interface{}{},
+		labels:     map[string]string{},
+	}
+}
+
+func (s *productRelationSet) add(productID int64, productCode, key, label string, row []interface{}) {
+	if _, ok := s.rows[productID]; !ok {
+		s.order = append(s.order, productID)
+		s.codes[productID] = productCode
+		s.rows[productID] = map[string][]interface{}{}
+	}
+	if _, ok := s.rows[productID][key]; !ok {
+		s.keys[productID] = append(s.keys[productID], key)
+	}
+	s.rows[productID][key] = row
+	s.labels[key] = label
+}
+
+func (s *productRelationSet) label(key string) string {
+	if l, ok := s.labels[key]; ok && l != "" {
+		return l
+	}
+	return key
+}
+
+// reconcile makes the table match the sheet for every product listed in it:
+// missing rows are inserted and, with replace, rows not in the sheet are
+// deleted. Products that do not appear in the sheet are left as they are.
+func (s *productRelationSet) reconcile(tx *sql.Tx, replace bool, report *importReport) (int, int, error) {
+	added := 0
+	removed := 0
+	for _, productID := range s.order {
+		q := fmt.Sprintf("SELECT DISTINCT CAST(`%s` AS CHAR) FROM `%s` WHERE product_id = ?", s.keyCol, s.table)
+		rows, err := tx.Query(q, productID)
+		if err != nil {
+			return added, removed, err
+		}
+		existing := []string{}
+		for rows.Next() {
+			var key sql.NullString
+			if err := rows.Scan(&key); err != nil {
+				rows.Close()
+				return added, removed, err
+			}
+			existing = append(existing, key.String)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return added, removed, err
+		}
+
+		isExisting := map[string]bool{}
+		for _, key := range existing {
+			isExisting[key] = true
+		}
+
+		wanted := s.rows[productID]
+		code := s.codes[productID]
+		insertRows := [][]interface{}{}
+		for _, key := range s.keys[productID] {
+			if !isExisting[key] {
+				insertRows = append(insertRows, wanted[key])
+				report.add(code, s.sheet, "tambah", s.label(key))
+				continue
+			}
+			if len(s.updateCols) == 0 {
+				continue
+			}
+			sets := []string{}
+			args := []interface{}{}
+			for _, col := range s.updateCols {
+				for i, c := range s.cols {
+					if c == col {
+						sets = append(sets, fmt.Sprintf("`%s` = ?", col))
+						args = append(args, wanted[key][i])
+					}
+				}
+			}
+			args = append(args, productID, key)
+			res, err := tx.Exec(fmt.Sprintf("UPDATE `%s` SET %s WHERE product_id = ? AND `%s` = ?", s.table, strings.Join(sets, ", "), s.keyCol), args...)
+			if err != nil {
+				return added, removed, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				report.add(code, s.sheet, "ubah", s.label(key))
+			}
+		}
+		if len(insertRows) > 0 {
+			q, args := buildMultiInsert(fmt.Sprintf("INSERT INTO `%s`", s.table), s.cols, insertRows)
+			if _, err := tx.Exec(q, args...); err != nil {
+				return added, removed, err
+			}
+			added += len(insertRows)
+		}
+
+		if !replace {
+			continue
+		}
+		for _, key := range existing {
+			if _, ok := wanted[key]; ok {
+				continue
+			}
+			if _, err := tx.Exec(fmt.Sprintf("DELETE FROM `%s` WHERE product_id = ? AND `%s` = ?", s.table, s.keyCol), productID, key); err != nil {
+				return added, removed, err
+			}
+			report.add(code, s.sheet, "hapus", s.label(key))
+			removed++
+		}
+	}
+	return added, removed, nil
+}
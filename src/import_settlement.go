@@ -19,6 +19,13 @@ func RunImportSettlementCmd(args []string) {
 	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
 	adminID := fs.Int("admin-id", 1, "createdBy admin id")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	tolerance := fs.String("tolerance", "1", "rounding tolerance for amount checks")
+	overpayDeposit := fs.Bool("overpay-deposit", false, "book overpayments as outlet deposit instead of rejecting the row")
+	reportPath := fs.String("report", "", "path to xlsx report of amount mismatches and collector fallbacks (optional)")
+	missingRegion := fs.String("missing-region", MissingRegionReject, "branch without a collection region: reject|create|map")
+	regionMapArg := fs.String("region-map", "", "for --missing-region=map: branch_code=region_code pairs (comma list or file)")
+	defaultCollector := fs.Int64("default-collector", 0, "collector admin id when neither the file nor the region has one (default: reject the row)")
+	numberingFormat := fs.String("numbering-format", "", "document_code=format of DTH_DRAFT, DTH, CR, STL_DRAFT and STL numbers as the app writes them, one # per sequence digit, e.g. DTH=DTH/{BRANCH}/{YY}{MM}/##### (comma list or file, required)")
 	fs.Parse(args)
 
 	start := time.Now()
@@ -30,6 +37,37 @@ func RunImportSettlementCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	toleranceAmount, err := parseMoneyFlag("tolerance", *tolerance)
+	if err != nil {
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if *missingRegion != MissingRegionReject && *missingRegion != MissingRegionCreate && *missingRegion != MissingRegionMap {
+		resp.Message = "invalid missing-region policy: " + *missingRegion
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	regionMap, err := loadKeyValueList(*regionMapArg)
+	if err != nil {
+		resp.Message = "error reading region map: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	numberingPairs, err := loadKeyValueList(*numberingFormat)
+	var numberingFormats map[string]NumberingFormat
+	if err == nil {
+		numberingFormats, err = parseNumberingFormats(numberingPairs, DocDebtCollectionDraft, DocDebtCollection, DocCashierReceipt, DocSettlementDraft, DocSettlement)
+	}
+	if err != nil {
+		resp.Message = "invalid numbering-format: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
 		out, _ := json.Marshal(resp)
@@ -82,30 +120,49 @@ func RunImportSettlementCmd(args []string) {
 		os.Exit(1)
 	}
 
+	if err := requireColumns(tx, "list_debt_collection", "0001_debt_collection_reference_number.sql", "reference_number"); err != nil {
+		_ = tx.Rollback()
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
 	// Caches
 	invoiceCache := make(map[string]*InvoiceSettlementData)
 	regionCache := make(map[int64]*RegionData)
 	giroCache := make(map[string]*GiroData)
+	numbers := newNumberingService(tx, numberingFormats)
+	outstanding := newOutstandingTracker(tx)
+	amountReport := newImportReport("Selisih Pelunasan", "Baris", "No Invoice", "Jumlah Pelunasan", "Sisa Tagihan", "Selisih", "Keterangan")
+	collectorReport := newImportReport("Kolektor", "Baris", "No Invoice", "Kolektor File", "Kolektor Dipakai", "Keterangan")
+	skippedReport := newImportReport("Dilewati", "Baris", "No DTH", "No Invoice", "Keterangan")
+	dthHeaders := newDebtCollectionHeaders(tx, numbers, *adminID)
+	collectorCache := make(map[string]int64)
+	regionCollectorCache := make(map[int64]int64)
 
 	// Settlement giro aggregation
 	type GiroInvoiceItem struct {
 		SalesInvoiceID   int64
-		SettlementAmount float64
-		GiroAmount       float64
+		SettlementAmount Money
+		GiroAmount       Money
+		Overpayment      Money
 	}
 
 	type SettlementGiroGroup struct {
 		GiroID                int64
 		GiroNumber            string
 		GiroDueDate           string
+		GiroStatusID          int
 		PaymentMethod         int
+		DTHNumber             string
 		DTHDate               string
 		Collector             int64
 		BranchID              int64
 		RegionID              int64
 		OutletID              int64
-		TotalSettlementAmount float64
-		TotalGiroAmount       float64
+		TotalSettlementAmount Money
+		TotalGiroAmount       Money
 		InvoiceList           []GiroInvoiceItem
 	}
 
@@ -130,8 +187,10 @@ func RunImportSettlementCmd(args []string) {
 			continue
 		}
 
+		// the template's "Freetext" hint row is skipped; an empty DTH cell
+		// gets a generated number
 		dthNumberPtr := getCol(0)
-		if *dthNumberPtr == "Freetext" {
+		if dthNumberPtr != nil && *dthNumberPtr == "Freetext" {
 			continue
 		}
 		dthTypePtr := getCol(1)
@@ -143,6 +202,7 @@ func RunImportSettlementCmd(args []string) {
 		transferAmountPtr := getCol(13)
 		giroAmountPtr := getCol(14)
 		giroNumberPtr := getCol(15)
+		collectorPtr := getCol(16)
 
 		if invoiceNumberPtr == nil {
 			fmt.Println("invoice number nil")
@@ -163,14 +223,14 @@ func RunImportSettlementCmd(args []string) {
 
 		// Parse DTH date
 		dthDate := parseDateForSQL(dthDatePtr)
-		if dthDate == "" {
+		if dthDate == nil || dthDate == "" {
 			dthDate = time.Now().Format("2006-01-02")
 		}
 
-		settlementAmount := denormFloat(settlementAmountPtr)
-		cashAmount := denormFloat(cashAmountPtr)
-		transferAmount := denormFloat(transferAmountPtr)
-		giroAmount := denormFloat(giroAmountPtr)
+		settlementAmount := denormMoney(settlementAmountPtr)
+		cashAmount := denormMoney(cashAmountPtr)
+		transferAmount := denormMoney(transferAmountPtr)
+		giroAmount := denormMoney(giroAmountPtr)
 
 		// Get or cache invoice
 		var invoice *InvoiceSettlementData
@@ -202,42 +262,100 @@ func RunImportSettlementCmd(args []string) {
 		if cached, ok := regionCache[invoice.BranchID]; ok {
 			region = cached
 		} else {
-			var regData RegionData
-			err = tx.QueryRow(`
-				SELECT region_id
-				FROM list_region
-				WHERE region_purpose_id = 2 AND branch_id = ?
-				LIMIT 1
-			`, invoice.BranchID).Scan(&regData.RegionID)
-
-			if err == sql.ErrNoRows {
-				fmt.Printf("Region not found for branch: %d\n", invoice.BranchID)
-				continue
-			} else if err != nil {
+			regData, note, err := resolveCollectionRegion(tx, invoice.BranchID, *missingRegion, regionMap, *adminID)
+			if err != nil {
 				_ = tx.Rollback()
 				resp.Message = "error querying region: " + err.Error()
 				goto FINISH
 			}
+			if note != "" {
+				collectorReport.add(r+1, invoiceNumber, nil, nil, note)
+			}
 			region = &regData
 			regionCache[invoice.BranchID] = region
 		}
+		if region.RegionID == 0 {
+			fmt.Printf("Region not found for branch: %d\n", invoice.BranchID)
+			continue
+		}
 
-		// Get collector (default to 1 if not found)
-		collector := int64(1)
-		err = tx.QueryRow(`
-			SELECT ga.admin_id
-			FROM rel_admin_region rar
-			JOIN gemstone_admin ga ON ga.admin_id = rar.admin_id
-			WHERE region_id = ? AND rar.is_active = 1 AND rar.is_exclusive = 0 AND ga.is_collector = 1
-			LIMIT 1
-		`, region.RegionID).Scan(&collector)
-		if err == sql.ErrNoRows {
-			collector = 1
-		} else if err != nil {
+		// Collector: file column first, then the region collector, then --default-collector
+		collector := int64(0)
+		collectorName := getString(collectorPtr)
+		if collectorName != "" {
+			if id, ok := collectorCache[collectorName]; ok {
+				collector = id
+			} else {
+				collector, err = findAdminByNameOrCode(tx, collectorName)
+				if err != nil {
+					_ = tx.Rollback()
+					resp.Message = "error querying collector: " + err.Error()
+					goto FINISH
+				}
+				collectorCache[collectorName] = collector
+			}
+		}
+		if collector == 0 {
+			regionCollector, ok := regionCollectorCache[region.RegionID]
+			if !ok {
+				regionCollector, err = findRegionCollector(tx, region.RegionID)
+				if err != nil {
+					_ = tx.Rollback()
+					resp.Message = "error querying collector: " + err.Error()
+					goto FINISH
+				}
+				regionCollectorCache[region.RegionID] = regionCollector
+			}
+			switch {
+			case regionCollector != 0 && collectorName != "":
+				collector = regionCollector
+				collectorReport.add(r+1, invoiceNumber, collectorName, collector, "kolektor tidak ditemukan, pakai kolektor wilayah")
+			case regionCollector != 0:
+				collector = regionCollector
+			case *defaultCollector != 0:
+				collector = *defaultCollector
+				collectorReport.add(r+1, invoiceNumber, collectorName, collector, "tidak ada kolektor, pakai kolektor default")
+			default:
+				collectorReport.add(r+1, invoiceNumber, collectorName, nil, "tidak ada kolektor, baris ditolak")
+				continue
+			}
+		}
+		// a region created by --missing-region=create gets the first collector
+		// used on it, so the app can find the region's collector afterwards
+		if region.Created && regionCollectorCache[region.RegionID] == 0 {
+			if err := assignRegionCollector(tx, region.RegionID, collector); err != nil {
+				_ = tx.Rollback()
+				resp.Message = "error assigning region collector: " + err.Error()
+				goto FINISH
+			}
+			regionCollectorCache[region.RegionID] = collector
+			collectorReport.add(r+1, invoiceNumber, collectorName, collector, "kolektor ditugaskan ke wilayah penagihan baru")
+		}
+
+		// cash + transfer + giro must add up to the settlement amount
+		if diff := cashAmount + transferAmount + giroAmount - settlementAmount; diff.abs() > toleranceAmount {
+			amountReport.add(r+1, invoiceNumber, settlementAmount, nil, diff, "cash + transfer + giro tidak sama dengan jumlah pelunasan, baris ditolak")
+			continue
+		}
+
+		// the settlement must stay within the invoice outstanding
+		var remaining Money
+		remaining, err = outstanding.remaining(invoice.SalesInvoiceID, invoiceNumber, invoice.Amount)
+		if err != nil {
 			_ = tx.Rollback()
-			resp.Message = "error querying collector: " + err.Error()
+			resp.Message = "error querying invoice outstanding: " + err.Error()
 			goto FINISH
 		}
+		overpayment := Money(0)
+		if settlementAmount > remaining+toleranceAmount {
+			overpayment = settlementAmount - maxMoney(remaining, 0)
+			if !*overpayDeposit {
+				amountReport.add(r+1, invoiceNumber, settlementAmount, remaining, overpayment, "lebih bayar, baris ditolak")
+				continue
+			}
+			amountReport.add(r+1, invoiceNumber, settlementAmount, remaining, overpayment, "lebih bayar, selisih dijadikan deposit outlet")
+			settlementAmount -= overpayment
+		}
 
 		// Parse payment method
 		paymentMethod := 1 // default cash
@@ -255,10 +373,17 @@ func RunImportSettlementCmd(args []string) {
 		// Handle GIRO payment - aggregate and continue
 		if paymentMethod == 3 {
 			if giroNumberPtr == nil {
-				fmt.Println("giro number nil")
+				skippedReport.add(r+1, getString(dthNumberPtr), invoiceNumber, "nomor giro kosong")
 				continue
 			}
 			giroNumber := strings.TrimSpace(*giroNumberPtr)
+			// the giro pays the settlement; an overpayment booked as deposit
+			// is not part of it, on the header nor on the lines
+			giroNet := giroAmount - overpayment
+			if giroNet < 0 {
+				skippedReport.add(r+1, getString(dthNumberPtr), invoiceNumber, fmt.Sprintf("nilai giro %s lebih kecil dari lebih bayar %s", giroAmount, overpayment))
+				continue
+			}
 
 			// Get or cache giro
 			var giro *GiroData
@@ -267,14 +392,14 @@ func RunImportSettlementCmd(args []string) {
 			} else {
 				var gData GiroData
 				err = tx.QueryRow(`
-					SELECT giro_id, due_date
+					SELECT giro_id, due_date, status_id
 					FROM list_giro_check
 					WHERE giro_number = ?
 					LIMIT 1
-				`, giroNumber).Scan(&gData.GiroID, &gData.DueDate)
+				`, giroNumber).Scan(&gData.GiroID, &gData.DueDate, &gData.StatusID)
 
 				if err == sql.ErrNoRows {
-					log.Printf("Missing Giro: %s\n", giroNumber)
+					skippedReport.add(r+1, getString(dthNumberPtr), invoiceNumber, "giro "+giroNumber+" tidak ditemukan")
 					continue
 				} else if err != nil {
 					_ = tx.Rollback()
@@ -284,6 +409,10 @@ func RunImportSettlementCmd(args []string) {
 				giro = &gData
 				giroCache[giroNumber] = giro
 			}
+			if giro.StatusID != GiroStatusPending && giro.StatusID != GiroStatusCleared {
+				skippedReport.add(r+1, getString(dthNumberPtr), invoiceNumber, fmt.Sprintf("giro %s berstatus %s, tidak bisa dipakai pelunasan", giroNumber, giroStatusName(giro.StatusID)))
+				continue
+			}
 
 			// Insert rel_giro_invoice
 			_, err = tx.Exec(`
@@ -302,7 +431,9 @@ func RunImportSettlementCmd(args []string) {
 					GiroID:        giro.GiroID,
 					GiroNumber:    giroNumber,
 					GiroDueDate:   giro.DueDate,
+					GiroStatusID:  giro.StatusID,
 					PaymentMethod: paymentMethod,
+					DTHNumber:     getString(dthNumberPtr),
 					DTHDate:       dthDate.(string),
 					Collector:     collector,
 					BranchID:      invoice.BranchID,
@@ -313,36 +444,35 @@ func RunImportSettlementCmd(args []string) {
 			}
 
 			group := settlementGiroList[giro.GiroID]
+			if group.DTHNumber == "" {
+				group.DTHNumber = getString(dthNumberPtr)
+			}
 			group.TotalSettlementAmount += settlementAmount
-			group.TotalGiroAmount += giroAmount
+			group.TotalGiroAmount += giroNet
 			group.InvoiceList = append(group.InvoiceList, GiroInvoiceItem{
 				SalesInvoiceID:   invoice.SalesInvoiceID,
 				SettlementAmount: settlementAmount,
-				GiroAmount:       giroAmount,
+				GiroAmount:       giroNet,
+				Overpayment:      overpayment,
 			})
+			outstanding.apply(invoice.SalesInvoiceID, settlementAmount)
 			fmt.Println("skip regular settlement for giro")
 			continue // Skip regular settlement for giro
 		}
 
-		// Regular settlement (Cash/Transfer)
-		// Generate draft_dth_number and dth_number (simplified - should use proper generator)
-		draftDTHNumber := fmt.Sprintf("DRAFT-DTH-%d-%d", invoice.BranchID, time.Now().UnixNano())
-		dthNumber := fmt.Sprintf("DTH-%d-%d", invoice.BranchID, time.Now().UnixNano())
-
-		// INSERT list_debt_collection
-		res, err := tx.Exec(`
-			INSERT INTO list_debt_collection (
-				debt_collection_draft_number, debt_collection_number, debt_collection_date,
-				debt_collection_status_id, debt_collection_type_id, collector,
-				branch_id, region_id, createdAt, createdBy, approvedAt, approvedBy
-			) VALUES (?, ?, ?, 3, 1, ?, ?, ?, NOW(), ?, NOW(), ?)
-		`, draftDTHNumber, dthNumber, dthDate, collector, invoice.BranchID, region.RegionID, *adminID, *adminID)
+		// Regular settlement (Cash/Transfer), under one DTH per file DTH number
+		docDate := numberingDate(dthDate)
+		dth, note, err := dthHeaders.get(getString(dthNumberPtr), dthDate.(string), collector, invoice.BranchID, region.RegionID)
 		if err != nil {
 			_ = tx.Rollback()
 			resp.Message = "error inserting debt collection: " + err.Error()
 			goto FINISH
 		}
-		dthID, _ := res.LastInsertId()
+		if dth == nil {
+			skippedReport.add(r+1, getString(dthNumberPtr), invoiceNumber, note)
+			continue
+		}
+		dthID := dth.ID
 
 		// INSERT rel_debt_collection_invoice
 		_, err = tx.Exec(`
@@ -354,9 +484,15 @@ func RunImportSettlementCmd(args []string) {
 			resp.Message = "error inserting debt collection invoice: " + err.Error()
 			goto FINISH
 		}
+		var res sql.Result
 
 		// Generate cashier receipt number
-		cashierReceiptNumber := fmt.Sprintf("CR-%d-%d", invoice.BranchID, time.Now().UnixNano())
+		cashierReceiptNumber, err := numbers.next(DocCashierReceipt, invoice.BranchID, docDate)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error generating cashier receipt number: " + err.Error()
+			goto FINISH
+		}
 
 		// INSERT list_cashier_receipt
 		res, err = tx.Exec(`
@@ -373,8 +509,18 @@ func RunImportSettlementCmd(args []string) {
 		cashierReceiptID, _ := res.LastInsertId()
 
 		// Generate settlement numbers
-		draftSettlementNumber := fmt.Sprintf("DRAFT-STL-%d-%d", invoice.BranchID, time.Now().UnixNano())
-		settlementNumber := fmt.Sprintf("STL-%d-%d", invoice.BranchID, time.Now().UnixNano())
+		draftSettlementNumber, err := numbers.next(DocSettlementDraft, invoice.BranchID, docDate)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error generating settlement number: " + err.Error()
+			goto FINISH
+		}
+		settlementNumber, err := numbers.next(DocSettlement, invoice.BranchID, docDate)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error generating settlement number: " + err.Error()
+			goto FINISH
+		}
 
 		// INSERT list_settlement
 		res, err = tx.Exec(`
@@ -423,30 +569,35 @@ func RunImportSettlementCmd(args []string) {
 			resp.Message = "error inserting settle invoice: " + err.Error()
 			goto FINISH
 		}
+		outstanding.apply(invoice.SalesInvoiceID, settlementAmount)
+
+		if overpayment > 0 {
+			err = insertOverpaymentDeposit(tx, dthDate, settlementNumber, invoice.BranchID, invoice.OutletID, overpayment, settlementID, invoice.SalesInvoiceID, *adminID)
+			if err != nil {
+				_ = tx.Rollback()
+				resp.Message = "error inserting overpayment deposit: " + err.Error()
+				goto FINISH
+			}
+		}
 
 		insertedCount++
 	}
 
 	// Process aggregated GIRO settlements
 	for _, giroGroup := range settlementGiroList {
-		// Generate numbers
-		draftDTHNumber := fmt.Sprintf("DRAFT-DTH-GIRO-%d-%d", giroGroup.BranchID, time.Now().UnixNano())
-		dthNumber := fmt.Sprintf("DTH-GIRO-%d-%d", giroGroup.BranchID, time.Now().UnixNano())
-
-		// INSERT list_debt_collection (status 3 for giro)
-		res, err := tx.Exec(`
-			INSERT INTO list_debt_collection (
-				debt_collection_draft_number, debt_collection_number, debt_collection_date,
-				debt_collection_status_id, debt_collection_type_id, collector,
-				branch_id, region_id, createdAt, createdBy, approvedAt, approvedBy
-			) VALUES (?, ?, ?, 3, 1, ?, ?, ?, NOW(), ?, NOW(), ?)
-		`, draftDTHNumber, dthNumber, giroGroup.DTHDate, giroGroup.Collector, giroGroup.BranchID, giroGroup.RegionID, *adminID, *adminID)
+		docDate := numberingDate(giroGroup.DTHDate)
+		dth, note, err := dthHeaders.get(giroGroup.DTHNumber, giroGroup.DTHDate, giroGroup.Collector, giroGroup.BranchID, giroGroup.RegionID)
 		if err != nil {
 			_ = tx.Rollback()
 			resp.Message = "error inserting giro debt collection: " + err.Error()
 			goto FINISH
 		}
-		dthID, _ := res.LastInsertId()
+		if dth == nil {
+			skippedReport.add(nil, giroGroup.DTHNumber, giroGroup.GiroNumber, note)
+			continue
+		}
+		dthID := dth.ID
+		var res sql.Result
 
 		// INSERT rel_debt_collection_invoice for each invoice in group
 		for _, invItem := range giroGroup.InvoiceList {
@@ -462,7 +613,12 @@ func RunImportSettlementCmd(args []string) {
 		}
 
 		// Generate cashier receipt number
-		cashierReceiptNumber := fmt.Sprintf("CR-GIRO-%d-%d", giroGroup.BranchID, time.Now().UnixNano())
+		cashierReceiptNumber, err := numbers.next(DocCashierReceipt, giroGroup.BranchID, docDate)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error generating giro cashier receipt number: " + err.Error()
+			goto FINISH
+		}
 
 		// INSERT list_cashier_receipt (giro only)
 		res, err = tx.Exec(`
@@ -479,8 +635,18 @@ func RunImportSettlementCmd(args []string) {
 		cashierReceiptID, _ := res.LastInsertId()
 
 		// Generate settlement numbers
-		draftSettlementNumber := fmt.Sprintf("DRAFT-STL-GIRO-%d-%d", giroGroup.BranchID, time.Now().UnixNano())
-		settlementNumber := fmt.Sprintf("STL-GIRO-%d-%d", giroGroup.BranchID, time.Now().UnixNano())
+		draftSettlementNumber, err := numbers.next(DocSettlementDraft, giroGroup.BranchID, docDate)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error generating giro settlement number: " + err.Error()
+			goto FINISH
+		}
+		settlementNumber, err := numbers.next(DocSettlement, giroGroup.BranchID, docDate)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error generating giro settlement number: " + err.Error()
+			goto FINISH
+		}
 
 		// INSERT list_settlement
 		res, err = tx.Exec(`
@@ -488,8 +654,8 @@ func RunImportSettlementCmd(args []string) {
 				settlement_date, settlement_draft_number, settlement_number,
 				debt_collection_id, cashier_receipt_id, settlement_status_id,
 				branch_id, createdAt, createdBy
-			) VALUES (?, ?, ?, ?, ?, 2, ?, NOW(), ?)
-		`, giroGroup.DTHDate, draftSettlementNumber, settlementNumber, dthID, cashierReceiptID, giroGroup.BranchID, *adminID)
+			) VALUES (?, ?, ?, ?, ?, ?, ?, NOW(), ?)
+		`, giroGroup.DTHDate, draftSettlementNumber, settlementNumber, dthID, cashierReceiptID, settlementStatusForGiro(giroGroup.GiroStatusID), giroGroup.BranchID, *adminID)
 		if err != nil {
 			_ = tx.Rollback()
 			resp.Message = "error inserting giro settlement: " + err.Error()
@@ -538,6 +704,14 @@ func RunImportSettlementCmd(args []string) {
 				resp.Message = "error inserting giro settle invoice: " + err.Error()
 				goto FINISH
 			}
+			if invItem.Overpayment > 0 {
+				err = insertOverpaymentDeposit(tx, giroGroup.DTHDate, settlementNumber, giroGroup.BranchID, giroGroup.OutletID, invItem.Overpayment, settlementID, invItem.SalesInvoiceID, *adminID)
+				if err != nil {
+					_ = tx.Rollback()
+					resp.Message = "error inserting overpayment deposit: " + err.Error()
+					goto FINISH
+				}
+			}
 		}
 
 		// UPDATE list_giro_check with settlement_id
@@ -553,6 +727,13 @@ func RunImportSettlementCmd(args []string) {
 		insertedCount++
 	}
 
+	// invoices left partly unpaid by this file
+	for _, invoiceID := range outstanding.order {
+		if left := outstanding.left[invoiceID]; left > toleranceAmount {
+			amountReport.add(nil, outstanding.numbers[invoiceID], nil, left, left, "kurang bayar, sisa tagihan masih terbuka")
+		}
+	}
+
 	// Commit transaction
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
@@ -560,9 +741,14 @@ func RunImportSettlementCmd(args []string) {
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, amountReport, collectorReport, skippedReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import Settlement Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d settlements inserted. Execution Time: %.4fs", insertedCount, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d settlements inserted under %d DTH, %d amount mismatches, %d collector/region notes, %d rows skipped. Execution Time: %.4fs",
+		insertedCount, dthHeaders.count(), amountReport.count(), collectorReport.count(), skippedReport.count(), time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
@@ -570,19 +756,189 @@ FINISH:
 	log.Printf("import settlement complete: %d settlements, time=%.4fs\n", insertedCount, time.Since(start).Seconds())
 }
 
+// debtCollectionHeaders keeps one list_debt_collection row per DTH number
+// of the file, so all invoices collected on a DTH sit under one header, as
+// in the app. The header gets a number in the app format; the file's number
+// is kept as reference_number for settlement-reverse --dth. Rows without a
+// DTH number get a header each.
+type debtCollectionHeaders struct {
+	tx          *sql.Tx
+	numbers     *numberingService
+	adminID     int
+	byReference map[string]*DebtCollectionHeader
+	created     int
+}
+
+func newDebtCollectionHeaders(tx *sql.Tx, numbers *numberingService, adminID int) *debtCollectionHeaders {
+	return &debtCollectionHeaders{tx: tx, numbers: numbers, adminID: adminID, byReference: map[string]*DebtCollectionHeader{}}
+}
+
+// get returns the header of reference, inserting it on first use. A row of
+// the same DTH for another branch gives a nil header and the reason.
+func (h *debtCollectionHeaders) get(reference, date string, collector, branchID, regionID int64) (*DebtCollectionHeader, string, error) {
+	if d, ok := h.byReference[reference]; ok && reference != "" {
+		if d.BranchID != branchID {
+			return nil, fmt.Sprintf("DTH %s sudah dipakai cabang lain, baris ditolak", reference), nil
+		}
+		return d, "", nil
+	}
+	docDate := numberingDate(date)
+	draftNumber, err := h.numbers.next(DocDebtCollectionDraft, branchID, docDate)
+	if err != nil {
+		return nil, "", err
+	}
+	number, err := h.numbers.next(DocDebtCollection, branchID, docDate)
+	if err != nil {
+		return nil, "", err
+	}
+	res, err := h.tx.Exec(`
+		INSERT INTO list_debt_collection (
+			debt_collection_draft_number, debt_collection_number, reference_number, debt_collection_date,
+			debt_collection_status_id, debt_collection_type_id, collector,
+			branch_id, region_id, createdAt, createdBy, approvedAt, approvedBy
+		) VALUES (?, ?, ?, ?, 3, 1, ?, ?, ?, NOW(), ?, NOW(), ?)
+	`, draftNumber, number, nullIfEmpty(reference), date, collector, branchID, regionID, h.adminID, h.adminID)
+	if err != nil {
+		return nil, "", err
+	}
+	id, _ := res.LastInsertId()
+	d := &DebtCollectionHeader{ID: id, Number: number, BranchID: branchID}
+	if reference != "" {
+		h.byReference[reference] = d
+	}
+	h.created++
+	return d, "", nil
+}
+
+func (h *debtCollectionHeaders) count() int {
+	return h.created
+}
+
+// Policies for --missing-region
+const (
+	MissingRegionReject = "reject"
+	MissingRegionCreate = "create"
+	MissingRegionMap    = "map"
+)
+
+// resolveCollectionRegion finds the collection region (purpose 2) of a
+// branch. When there is none the policy decides: reject returns 0, create
+// inserts a collection region for the branch (its collector is assigned by
+// the caller once one is known) and map uses the region code given for the
+// branch code.
+func resolveCollectionRegion(tx *sql.Tx, branchID int64, policy string, regionMap map[string]string, adminID int) (RegionData, string, error) {
+	var regionID int64
+	err := tx.QueryRow(`
+		SELECT region_id
+		FROM list_region
+		WHERE region_purpose_id = 2 AND branch_id = ?
+		LIMIT 1
+	`, branchID).Scan(&regionID)
+	if err == nil {
+		return RegionData{RegionID: regionID}, "", nil
+	}
+	if err != sql.ErrNoRows {
+		return RegionData{}, "", err
+	}
+
+	var branchCode sql.NullString
+	if err := tx.QueryRow("SELECT branch_code FROM list_branch WHERE branch_id = ? LIMIT 1", branchID).Scan(&branchCode); err != nil && err != sql.ErrNoRows {
+		return RegionData{}, "", err
+	}
+
+	switch policy {
+	case MissingRegionCreate:
+		if branchCode.String == "" {
+			return RegionData{}, fmt.Sprintf("cabang %d tidak punya kode cabang, wilayah penagihan tidak dibuat", branchID), nil
+		}
+		regionCode := "COL-" + branchCode.String
+		res, err := tx.Exec(`INSERT INTO list_region (region_name, region_code, branch_id, region_type_id, region_status_id, region_purpose_id, createdAt, createdBy)
+			VALUES (?, ?, ?, 1, 2, 2, NOW(), ?)`, "PENAGIHAN "+branchCode.String, regionCode, branchID, adminID)
+		if err != nil {
+			return RegionData{}, "", err
+		}
+		regionID, _ = res.LastInsertId()
+		return RegionData{RegionID: regionID, Created: true}, fmt.Sprintf("wilayah penagihan cabang %s dibuat (%s)", branchCode.String, regionCode), nil
+
+	case MissingRegionMap:
+		regionCode, ok := regionMap[branchCode.String]
+		if !ok {
+			return RegionData{}, fmt.Sprintf("cabang %s tidak punya wilayah penagihan dan tidak ada di region-map, dilewati", branchCode.String), nil
+		}
+		err := tx.QueryRow("SELECT region_id FROM list_region WHERE region_code = ? LIMIT 1", regionCode).Scan(&regionID)
+		if err == sql.ErrNoRows {
+			return RegionData{}, fmt.Sprintf("wilayah %s dari region-map tidak ditemukan, dilewati", regionCode), nil
+		}
+		if err != nil {
+			return RegionData{}, "", err
+		}
+		return RegionData{RegionID: regionID}, fmt.Sprintf("cabang %s dipetakan ke wilayah %s", branchCode.String, regionCode), nil
+	}
+
+	return RegionData{}, fmt.Sprintf("cabang %s tidak punya wilayah penagihan, dilewati", branchCode.String), nil
+}
+
+// assignRegionCollector makes admin the active, non exclusive collector of a
+// region, the way findRegionCollector reads it back.
+func assignRegionCollector(tx *sql.Tx, regionID, adminID int64) error {
+	_, err := tx.Exec(`INSERT INTO rel_admin_region (admin_id, region_id, is_active, is_exclusive) VALUES (?, ?, 1, 0)`, adminID, regionID)
+	return err
+}
+
+// findAdminByNameOrCode looks a collector up by admin_name (login code) or
+// full name. It returns 0 when nothing matches.
+func findAdminByNameOrCode(tx *sql.Tx, name string) (int64, error) {
+	var adminID int64
+	err := tx.QueryRow(`
+		SELECT admin_id FROM gemstone_admin
+		WHERE admin_name = ? OR admin_fullname = ?
+		ORDER BY is_collector DESC
+		LIMIT 1
+	`, name, name).Scan(&adminID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return adminID, err
+}
+
+// findRegionCollector returns the first active, non exclusive collector of a
+// region, or 0.
+func findRegionCollector(tx *sql.Tx, regionID int64) (int64, error) {
+	var adminID int64
+	err := tx.QueryRow(`
+		SELECT ga.admin_id
+		FROM rel_admin_region rar
+		JOIN gemstone_admin ga ON ga.admin_id = rar.admin_id
+		WHERE region_id = ? AND rar.is_active = 1 AND rar.is_exclusive = 0 AND ga.is_collector = 1
+		LIMIT 1
+	`, regionID).Scan(&adminID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return adminID, err
+}
+
 // Helper structs
 type InvoiceSettlementData struct {
 	SalesInvoiceID int64
 	BranchID       int64
 	OutletID       int64
-	Amount         float64
+	Amount         Money
 }
 
 type RegionData struct {
 	RegionID int64
+	Created  bool
 }
 
 type GiroData struct {
-	GiroID  int64
-	DueDate string
+	GiroID   int64
+	DueDate  string
+	StatusID int
+}
+
+type DebtCollectionHeader struct {
+	ID       int64
+	Number   string
+	BranchID int64
 }
@@ -0,0 +1,279 @@
+package src
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// RunSettlementReverseCmd removes the whole settlement chain of one or more
+// DTH numbers (list_debt_collection.debt_collection_number, or the legacy
+// number from the settlement file in reference_number) so the invoices are
+// open again.
+func RunSettlementReverseCmd(args []string) {
+	fs := flag.NewFlagSet("settlement-reverse", flag.ExitOnError)
+	dthArg := fs.String("dth", "", "DTH numbers to reverse (comma list or file, one per line)")
+	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
+	logID := fs.String("log-id", "", "optional log_id to update activity on success")
+	reportPath := fs.String("report", "", "path to xlsx report of reversed rows (optional)")
+	dryRun := fs.Bool("dry-run", false, "report what would be reversed and roll back")
+	fs.Parse(args)
+
+	start := time.Now()
+	resp := Response{Success: false}
+	reversedCount := 0
+	report := newSettlementReversalReport()
+
+	if *dsn == "" {
+		resp.Message = "dsn is required"
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	dthNumbers, err := readListValue(*dthArg)
+	if err != nil {
+		resp.Message = "error reading dth list: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if len(dthNumbers) == 0 {
+		resp.Message = "dth is required"
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		resp.Message = "db open error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		resp.Message = "db begin error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	for _, dthNumber := range dthNumbers {
+		// one file DTH number can sit on several headers (earlier imports
+		// wrote one per invoice); all of them are undone
+		var dthIDs []int64
+		dthIDs, err = findDebtCollections(tx, dthNumber)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error querying debt collection: " + err.Error()
+			goto FINISH
+		}
+		if len(dthIDs) == 0 {
+			fmt.Println("DTH tidak ditemukan: ", dthNumber)
+			report.add(dthNumber, nil, nil, nil, "DTH tidak ditemukan")
+			continue
+		}
+
+		for _, dthID := range dthIDs {
+			if _, err = reverseSettlementChain(tx, dthID, dthNumber, report); err != nil {
+				_ = tx.Rollback()
+				resp.Message = fmt.Sprintf("error reversing %s: %s", dthNumber, err.Error())
+				goto FINISH
+			}
+			log.Printf("reversed DTH %s (id %d)\n", dthNumber, dthID)
+		}
+		reversedCount++
+	}
+
+	if *dryRun {
+		_ = tx.Rollback()
+	} else if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		resp.Message = "db commit error: " + err.Error()
+		goto FINISH
+	}
+
+	if *logID != "" && !*dryRun {
+		tx2, err := db.Begin()
+		if err == nil {
+			_ = updateActivity(tx2, *logID, "REVERSE SETTLEMENT", "settlement/view_settlement_list", "{}")
+			_ = tx2.Commit()
+		}
+	}
+
+	if err := writeReports(*reportPath, report); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
+	resp.Success = true
+	resp.Message = "Reverse Settlement Success"
+	if *dryRun {
+		resp.Message = "Reverse Settlement Dry Run (rolled back)"
+	}
+	resp.MessageDetail = fmt.Sprintf("Total %d of %d DTH reversed, %d rows logged. Execution Time: %.4fs", reversedCount, len(dthNumbers), report.count(), time.Since(start).Seconds())
+
+FINISH:
+	out, _ := json.Marshal(resp)
+	fmt.Println(string(out))
+	log.Printf("settlement reverse complete: %d DTH, time=%.4fs\n", reversedCount, time.Since(start).Seconds())
+}
+
+func newSettlementReversalReport() *importReport {
+	return newImportReport("Reversal Pelunasan", "No DTH", "No Settlement", "No Invoice", "Jumlah", "Keterangan")
+}
+
+// findDebtCollections returns every debt collection whose number or
+// reference_number (the file's DTH number) is dthNumber.
+func findDebtCollections(tx *sql.Tx, dthNumber string) ([]int64, error) {
+	rows, err := tx.Query("SELECT debt_collection_id FROM list_debt_collection WHERE debt_collection_number = ? OR reference_number = ? ORDER BY debt_collection_id", dthNumber, dthNumber)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// reverseSettlementChain deletes everything the settlement importer wrote
+// for one debt collection: settle invoices, settlement groups, overpayment
+// deposits, settlements, cashier receipts, DTH invoices and the DTH itself.
+// Giros paid into it are detached (settlement_id NULL, rel_giro_invoice
+// removed). Every invoice payment that is undone goes to the report.
+func reverseSettlementChain(tx *sql.Tx, debtCollectionID int64, dthNumber string, report *importReport) (*SettlementReversal, error) {
+	rev := &SettlementReversal{DTHNumber: dthNumber}
+
+	settlements := []SettlementRef{}
+	rows, err := tx.Query("SELECT settlement_id, settlement_number FROM list_settlement WHERE debt_collection_id = ?", debtCollectionID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var s SettlementRef
+		var number sql.NullString
+		if err := rows.Scan(&s.SettlementID, &number); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		s.Number = number.String
+		settlements = append(settlements, s)
+	}
+	rows.Close()
+
+	for _, s := range settlements {
+		// invoice payments being undone
+		payRows, err := tx.Query(`
+			SELECT rsi.sales_invoice_id, lsi.sales_invoice_number, rsi.payment_amount
+			FROM rel_settle_invoice rsi
+			JOIN list_sales_invoice lsi ON lsi.sales_invoice_id = rsi.sales_invoice_id
+			WHERE rsi.settlement_id = ?
+		`, s.SettlementID)
+		if err != nil {
+			return nil, err
+		}
+		invoiceIDs := []int64{}
+		for payRows.Next() {
+			var invoiceID int64
+			var invoiceNumber string
+			var amount Money
+			if err := payRows.Scan(&invoiceID, &invoiceNumber, &amount); err != nil {
+				payRows.Close()
+				return nil, err
+			}
+			invoiceIDs = append(invoiceIDs, invoiceID)
+			report.add(dthNumber, s.Number, invoiceNumber, amount, "pembayaran dibatalkan")
+			rev.Amount += amount
+		}
+		payRows.Close()
+		rev.Invoices += len(invoiceIDs)
+
+		// detach giros paid into this settlement
+		giroRows, err := tx.Query("SELECT giro_id, giro_number FROM list_giro_check WHERE settlement_id = ?", s.SettlementID)
+		if err != nil {
+			return nil, err
+		}
+		giros := map[int64]string{}
+		for giroRows.Next() {
+			var giroID int64
+			var giroNumber string
+			if err := giroRows.Scan(&giroID, &giroNumber); err != nil {
+				giroRows.Close()
+				return nil, err
+			}
+			giros[giroID] = giroNumber
+		}
+		giroRows.Close()
+		for giroID, giroNumber := range giros {
+			for _, invoiceID := range invoiceIDs {
+				if _, err := tx.Exec("DELETE FROM rel_giro_invoice WHERE giro_id = ? AND sales_invoice_id = ?", giroID, invoiceID); err != nil {
+					return nil, err
+				}
+			}
+			if _, err := tx.Exec("UPDATE list_giro_check SET settlement_id = NULL WHERE giro_id = ?", giroID); err != nil {
+				return nil, err
+			}
+			report.add(dthNumber, s.Number, nil, nil, "giro "+giroNumber+" dilepas dari pelunasan")
+			rev.Giros++
+		}
+
+		res, err := tx.Exec("DELETE FROM list_outlet_deposit WHERE settlement_id = ? AND debit > 0", s.SettlementID)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			report.add(dthNumber, s.Number, nil, nil, fmt.Sprintf("%d deposit lebih bayar dihapus", n))
+			rev.Deposits += int(n)
+		}
+
+		for _, q := range []string{
+			"DELETE FROM rel_settle_invoice WHERE settlement_id = ?",
+			"DELETE FROM list_settlement_group WHERE settlement_id = ?",
+			"DELETE FROM list_settlement WHERE settlement_id = ?",
+		} {
+			if _, err := tx.Exec(q, s.SettlementID); err != nil {
+				return nil, err
+			}
+		}
+		rev.Settlements++
+	}
+
+	for _, q := range []string{
+		"DELETE FROM list_cashier_receipt WHERE debt_collection_id = ?",
+		"DELETE FROM rel_debt_collection_invoice WHERE debt_collection_id = ?",
+		"DELETE FROM list_debt_collection WHERE debt_collection_id = ?",
+	} {
+		if _, err := tx.Exec(q, debtCollectionID); err != nil {
+			return nil, err
+		}
+	}
+	report.add(dthNumber, nil, nil, rev.Amount, fmt.Sprintf("DTH dibatalkan: %d settlement, %d invoice, %d giro", rev.Settlements, rev.Invoices, rev.Giros))
+	return rev, nil
+}
+
+// Helper structs
+type SettlementRef struct {
+	SettlementID int64
+	Number       string
+}
+
+type SettlementReversal struct {
+	DTHNumber   string
+	Settlements int
+	Invoices    int
+	Giros       int
+	Deposits    int
+	Amount      Money
+}
@@ -20,6 +20,9 @@ func RunImportInitialStockCmd(args []string) {
 	adminID := fs.Int("admin-id", 1, "createdBy admin id")
 	batchSize := fs.Int("batch", 500, "batch size for inserts")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	batchCheck := fs.String("batch-check", BatchCheckWarn, "batch/expiry validation: enforce|warn|off")
+	asOfArg := fs.String("as-of", "", "date batches must still be sellable on, YYYY-MM-DD (default the opening stock date)")
+	reportPath := fs.String("report", "", "path to xlsx report of batch/expiry violations (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
@@ -31,6 +34,25 @@ func RunImportInitialStockCmd(args []string) {
 		fmt.Println(string(out))
 		os.Exit(1)
 	}
+	if !validBatchCheckMode(*batchCheck) {
+		resp.Message = "invalid batch-check mode: " + *batchCheck
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	// opening stock date; batches must still be sellable on the as-of date
+	txDate := "2025-09-29 00:00:00"
+	asOf, _ := time.Parse("2006-01-02 15:04:05", txDate)
+	if *asOfArg != "" {
+		d, ok := parseDateStrict(asOfArg)
+		if !ok || d == nil {
+			resp.Message = "invalid as-of date: " + *asOfArg
+			out, _ := json.Marshal(resp)
+			fmt.Println(string(out))
+			os.Exit(1)
+		}
+		asOf, _ = time.Parse("2006-01-02", d.(string))
+	}
 	if _, err := os.Stat(*filePath); err != nil {
 		resp.Message = fmt.Sprintf("file not found: %s", *filePath)
 		out, _ := json.Marshal(resp)
@@ -99,6 +121,8 @@ func RunImportInitialStockCmd(args []string) {
 	// cache for existing/inserted product batch (key -> batch_id)
 	batchCache := map[string]int64{}
 
+	batchValidator := newBatchExpiryValidator(*batchCheck, true, asOf)
+
 	for r := 1; r < len(rows); r++ { // skip header row (index 0)
 		rowIndex++
 		cols := rows[r]
@@ -153,9 +177,6 @@ func RunImportInitialStockCmd(args []string) {
 			isConsignment = 1
 		}
 
-		// parse expired date to YYYY-MM-DD ("" allowed)
-		expiredDate := parseDateForSQL(rawDatePtr)
-
 		// --- lookup branch ---
 		var branchID int64
 		err = tx.QueryRow("SELECT branch_id FROM list_branch WHERE branch_code = ? LIMIT 1", branchCode).Scan(&branchID)
@@ -181,32 +202,24 @@ func RunImportInitialStockCmd(args []string) {
 			goto FINISH
 		}
 
+		// --- batch / expiry rules from product master ---
+		expiredDate, batchOK, err := batchValidator.validate(tx, r+1, productCode, productID, batchNumber, rawDatePtr)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error validating batch: " + err.Error()
+			goto FINISH
+		}
+		if !batchOK {
+			fmt.Println("Batch / expired tidak valid: ", productCode, batchNumber)
+			continue
+		}
+
 		// --- get or insert product batch (cache) ---
-		batchKey := fmt.Sprintf("%d|%s|%s", productID, batchNumber, expiredDate)
-		var batchID int64
-		if id, ok := batchCache[batchKey]; ok {
-			batchID = id
-		} else {
-			// try select
-			err = tx.QueryRow("SELECT batch_id FROM list_product_batch WHERE product_id = ? AND batch_number = ? AND expired_date = ? LIMIT 1",
-				productID, batchNumber, expiredDate).Scan(&batchID)
-			if err == sql.ErrNoRows {
-				// insert single batch (we need id immediately)
-				res, errIns := tx.Exec("INSERT INTO list_product_batch (product_id, batch_number, expired_date, createdAt, createdBy) VALUES (?, ?, ?, NOW(), ?)",
-					productID, batchNumber, expiredDate, *adminID)
-				if errIns != nil {
-					_ = tx.Rollback()
-					resp.Message = "error inserting product batch: " + errIns.Error()
-					goto FINISH
-				}
-				li, _ := res.LastInsertId()
-				batchID = li
-			} else if err != nil {
-				_ = tx.Rollback()
-				resp.Message = "error querying product batch: " + err.Error()
-				goto FINISH
-			}
-			batchCache[batchKey] = batchID
+		batchID, err := getOrInsertProductBatch(tx, batchCache, productID, batchNumber, expiredDate, *adminID)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error getting product batch: " + err.Error()
+			goto FINISH
 		}
 
 		// --- lookup warehouse ---
@@ -237,9 +250,6 @@ func RunImportInitialStockCmd(args []string) {
 			goto FINISH
 		}
 
-		// createdAt := time.Now().Format("2006-01-02 15:04:05")
-		txDate := "2025-09-29 00:00:00"
-
 		// Prepare tx row values in same order as txCols
 		rowVals := []interface{}{
 			txDate,        // tx_date
@@ -351,9 +361,13 @@ func RunImportInitialStockCmd(args []string) {
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, batchValidator.report); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import Initial Stock Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted. Execution Time: %.4fs", insertedCount, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d rows inserted, %d batch/expiry violations, %d rows skipped. Execution Time: %.4fs", insertedCount, batchValidator.report.count(), batchValidator.skipped, time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
@@ -19,6 +19,7 @@ func RunImportTransferOutstandingCmd(args []string) {
 	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
 	adminID := fs.Int("admin-id", 1, "requestedBy admin id")
 	sheetName := fs.String("sheet", "", "sheet name (optional)")
+	reportPath := fs.String("report", "", "path to xlsx report of skipped rows and transfers (optional)")
 	fs.Parse(args)
 
 	start := time.Now()
@@ -85,9 +86,13 @@ func RunImportTransferOutstandingCmd(args []string) {
 	// Caches
 	invoiceCache := make(map[string]*InvoiceTransferData)
 	branchCache := make(map[string]int64)
-	depositCache := make(map[string]int64)
+	depositCache := make(map[string]*DepositTransferData)
 
+	skippedReport := newImportReport("Dilewati", "Baris", "No Transfer", "No Dokumen", "Keterangan")
+	groups := make(map[string]*TransferGroup)
+	groupOrder := []string{}
 	insertedCount := 0
+	lineCount := 0
 	rowIndex := 0
 
 	for r := 1; r < len(rows); r++ { // skip header
@@ -103,7 +108,8 @@ func RunImportTransferOutstandingCmd(args []string) {
 
 		// Minimum columns check
 		// indices: 0 transfer_number, 1 invoice_number, 2 branch_origin, 3 branch_destination,
-		//          4 transfer_note, 5 transfer_date, 7 transfer_type, 8 snapshot_amount, 9 snapshot_settlement
+		//          4 transfer_note, 5 transfer_date, 7 transfer_type, 8 snapshot_amount, 9 snapshot_settlement,
+		//          10 transfer_status (optional, empty = approved)
 		if len(rowData) < 8 {
 			fmt.Println("column lebih kecil dari 8")
 			continue
@@ -122,17 +128,29 @@ func RunImportTransferOutstandingCmd(args []string) {
 		transferTypePtr := getCol(7)
 		snapshotAmountPtr := getCol(8)
 		snapshotSettlementPtr := getCol(9)
+		transferStatusPtr := getCol(10)
 
+		transferNumber := strings.TrimSpace(*transferNumberPtr)
 		if invoiceNumberPtr == nil || branchOriginPtr == nil || branchDestinationPtr == nil || transferTypePtr == nil {
 			fmt.Println("invoice number kosong")
+			skippedReport.add(r+1, transferNumber, getString(invoiceNumberPtr), "nomor dokumen, cabang atau tipe transfer kosong")
 			continue
 		}
 
-		transferNumber := strings.TrimSpace(*transferNumberPtr)
 		invoiceNumber := strings.TrimSpace(*invoiceNumberPtr)
 		branchOriginName := strings.TrimSpace(*branchOriginPtr)
 		branchDestinationName := strings.TrimSpace(*branchDestinationPtr)
-		transferType := strings.ToLower(strings.TrimSpace(*transferTypePtr))
+
+		transferType := ""
+		typeStr := strings.ToLower(strings.TrimSpace(*transferTypePtr))
+		if strings.Contains(typeStr, "deposit") {
+			transferType = TransferTypeDeposit
+		} else if strings.Contains(typeStr, "outstanding") {
+			transferType = TransferTypeOutstanding
+		} else {
+			skippedReport.add(r+1, transferNumber, invoiceNumber, "tipe transfer tidak dikenal: "+*transferTypePtr)
+			continue
+		}
 
 		transferNote := ""
 		if transferNotePtr != nil {
@@ -141,10 +159,16 @@ func RunImportTransferOutstandingCmd(args []string) {
 
 		// Parse transfer date
 		transferDate := parseDateForSQL(transferDatePtr)
-		if transferDate == "" {
+		if transferDate == nil {
 			transferDate = time.Now().Format("2006-01-02")
 		}
 
+		approved := true
+		if transferStatusPtr != nil {
+			statusStr := strings.ToLower(strings.TrimSpace(*transferStatusPtr))
+			approved = strings.Contains(statusStr, "approve") || strings.Contains(statusStr, "setuju") || strings.Contains(statusStr, "selesai")
+		}
+
 		// Get or cache branch origin
 		var branchOriginID int64
 		if cached, ok := branchCache[branchOriginName]; ok {
@@ -159,6 +183,7 @@ func RunImportTransferOutstandingCmd(args []string) {
 
 			if err == sql.ErrNoRows {
 				fmt.Printf("Branch origin not found: %s\n", branchOriginName)
+				skippedReport.add(r+1, transferNumber, invoiceNumber, "cabang asal tidak ditemukan: "+branchOriginName)
 				continue
 			} else if err != nil {
 				_ = tx.Rollback()
@@ -182,6 +207,7 @@ func RunImportTransferOutstandingCmd(args []string) {
 
 			if err == sql.ErrNoRows {
 				fmt.Printf("Branch destination not found: %s\n", branchDestinationName)
+				skippedReport.add(r+1, transferNumber, invoiceNumber, "cabang tujuan tidak ditemukan: "+branchDestinationName)
 				continue
 			} else if err != nil {
 				_ = tx.Rollback()
@@ -191,120 +217,209 @@ func RunImportTransferOutstandingCmd(args []string) {
 			branchCache[branchDestinationName] = branchDestinationID
 		}
 
-		// Process based on transfer type
-		if strings.Contains(transferType, "deposit") {
-			// Get or cache deposit
-			var depositID int64
-			if cached, ok := depositCache[invoiceNumber]; ok {
-				depositID = cached
-			} else {
-				err = tx.QueryRow(`
-					SELECT deposit_id 
-					FROM list_outlet_deposit 
-					WHERE deposit_number = ? 
-					LIMIT 1
-				`, invoiceNumber).Scan(&depositID)
-
-				if err == sql.ErrNoRows {
-					log.Printf("Missing Deposit: %s\n", invoiceNumber)
-					continue
-				} else if err != nil {
-					_ = tx.Rollback()
-					resp.Message = "error querying deposit: " + err.Error()
-					goto FINISH
-				}
-				depositCache[invoiceNumber] = depositID
+		// Group rows by transfer number; header fields must agree
+		group, exists := groups[transferNumber]
+		if !exists {
+			group = &TransferGroup{
+				TransferNumber:      transferNumber,
+				TransferType:        transferType,
+				BranchOriginID:      branchOriginID,
+				BranchDestinationID: branchDestinationID,
+				TransferDate:        transferDate,
+				TransferNote:        transferNote,
+				Approved:            approved,
 			}
-
-			// INSERT list_deposit_transfer
-			res, err := tx.Exec(`
-				INSERT INTO list_deposit_transfer (
-					branch_source_id, branch_destination_id, request_number,
-					transfer_note, requestedAt, requestedBy
-				) VALUES (?, ?, ?, ?, ?, ?)
-			`, branchOriginID, branchDestinationID, transferNumber, transferNote, transferDate, *adminID)
-
-			if err != nil {
-				_ = tx.Rollback()
-				resp.Message = "error inserting deposit transfer: " + err.Error()
-				goto FINISH
+			groups[transferNumber] = group
+			groupOrder = append(groupOrder, transferNumber)
+		} else if group.Conflict == "" {
+			switch {
+			case group.TransferType != transferType:
+				group.Conflict = fmt.Sprintf("baris %d: tipe transfer berbeda", r+1)
+			case group.BranchOriginID != branchOriginID:
+				group.Conflict = fmt.Sprintf("baris %d: cabang asal berbeda", r+1)
+			case group.BranchDestinationID != branchDestinationID:
+				group.Conflict = fmt.Sprintf("baris %d: cabang tujuan berbeda", r+1)
+			case group.TransferDate != transferDate:
+				group.Conflict = fmt.Sprintf("baris %d: tanggal transfer berbeda", r+1)
+			case group.Approved != approved:
+				group.Conflict = fmt.Sprintf("baris %d: status transfer berbeda", r+1)
+			}
+			if group.TransferNote == "" {
+				group.TransferNote = transferNote
 			}
-			transferID, _ := res.LastInsertId()
+		}
+		if branchOriginID == branchDestinationID && group.Conflict == "" {
+			group.Conflict = fmt.Sprintf("baris %d: cabang asal sama dengan cabang tujuan", r+1)
+		}
+		group.Lines = append(group.Lines, TransferLine{
+			Row:                r + 1,
+			DocumentNumber:     invoiceNumber,
+			SnapshotAmount:     denormMoney(snapshotAmountPtr),
+			SnapshotSettlement: denormMoney(snapshotSettlementPtr),
+		})
+	}
 
-			// INSERT rel_deposit_transfer_transaction
-			_, err = tx.Exec(`
-				INSERT INTO rel_deposit_transfer_transaction (deposit_transfer_id, deposit_id)
-				VALUES (?, ?)
-			`, transferID, depositID)
+	for _, transferNumber := range groupOrder {
+		group := groups[transferNumber]
+		if group.Conflict != "" {
+			skippedReport.add(group.Lines[0].Row, transferNumber, nil, "transfer dilewati, "+group.Conflict)
+			continue
+		}
 
-			if err != nil {
-				_ = tx.Rollback()
-				resp.Message = "error inserting deposit transfer transaction: " + err.Error()
-				goto FINISH
-			}
+		headerTable, lineTable := "list_outstanding_transfer", "rel_outstanding_transfer_transaction"
+		if group.TransferType == TransferTypeDeposit {
+			headerTable, lineTable = "list_deposit_transfer", "rel_deposit_transfer_transaction"
+		}
 
-			insertedCount++
+		var dummy int
+		err = tx.QueryRow("SELECT 1 FROM "+headerTable+" WHERE request_number = ? LIMIT 1", transferNumber).Scan(&dummy)
+		if err == nil {
+			skippedReport.add(group.Lines[0].Row, transferNumber, nil, "transfer sudah ada di database")
+			continue
+		} else if err != sql.ErrNoRows {
+			_ = tx.Rollback()
+			resp.Message = "error checking transfer: " + err.Error()
+			goto FINISH
+		}
 
-		} else if strings.Contains(transferType, "outstanding") {
-			// Get or cache invoice
-			var invoice *InvoiceTransferData
-			if cached, ok := invoiceCache[invoiceNumber]; ok {
-				invoice = cached
+		// Resolve lines; each document must currently sit at the origin branch
+		type resolvedLine struct {
+			TransferLine
+			DocumentID int64
+			OutletID   int64
+		}
+		lines := []resolvedLine{}
+		seen := map[int64]bool{}
+		for _, line := range group.Lines {
+			rl := resolvedLine{TransferLine: line}
+			ownerBranchID := int64(0)
+			if group.TransferType == TransferTypeDeposit {
+				deposit, ok := depositCache[line.DocumentNumber]
+				if !ok {
+					var depData DepositTransferData
+					err = tx.QueryRow(`
+						SELECT deposit_id, branch_id
+						FROM list_outlet_deposit 
+						WHERE deposit_number = ? 
+						LIMIT 1
+					`, line.DocumentNumber).Scan(&depData.DepositID, &depData.BranchID)
+
+					if err == sql.ErrNoRows {
+						depositCache[line.DocumentNumber] = nil
+					} else if err != nil {
+						_ = tx.Rollback()
+						resp.Message = "error querying deposit: " + err.Error()
+						goto FINISH
+					} else {
+						deposit = &depData
+						depositCache[line.DocumentNumber] = deposit
+					}
+				}
+				if deposit == nil {
+					log.Printf("Missing Deposit: %s\n", line.DocumentNumber)
+					skippedReport.add(line.Row, transferNumber, line.DocumentNumber, "deposit tidak ditemukan")
+					continue
+				}
+				rl.DocumentID = deposit.DepositID
+				ownerBranchID = deposit.BranchID
 			} else {
-				var invData InvoiceTransferData
-				err = tx.QueryRow(`
-					SELECT sales_invoice_id, outlet_id
-					FROM list_sales_invoice
-					WHERE sales_invoice_number = ?
-					LIMIT 1
-				`, invoiceNumber).Scan(&invData.SalesInvoiceID, &invData.OutletID)
-
-				if err == sql.ErrNoRows {
-					log.Printf("Missing Invoice: %s\n", invoiceNumber)
+				invoice, ok := invoiceCache[line.DocumentNumber]
+				if !ok {
+					var invData InvoiceTransferData
+					err = tx.QueryRow(`
+						SELECT sales_invoice_id, outlet_id, branch_billing_id
+						FROM list_sales_invoice
+						WHERE sales_invoice_number = ?
+						LIMIT 1
+					`, line.DocumentNumber).Scan(&invData.SalesInvoiceID, &invData.OutletID, &invData.BranchBillingID)
+
+					if err == sql.ErrNoRows {
+						invoiceCache[line.DocumentNumber] = nil
+					} else if err != nil {
+						_ = tx.Rollback()
+						resp.Message = "error querying invoice: " + err.Error()
+						goto FINISH
+					} else {
+						invoice = &invData
+						invoiceCache[line.DocumentNumber] = invoice
+					}
+				}
+				if invoice == nil {
+					log.Printf("Missing Invoice: %s\n", line.DocumentNumber)
+					skippedReport.add(line.Row, transferNumber, line.DocumentNumber, "invoice tidak ditemukan")
 					continue
-				} else if err != nil {
-					_ = tx.Rollback()
-					resp.Message = "error querying invoice: " + err.Error()
-					goto FINISH
 				}
-				invoice = &invData
-				invoiceCache[invoiceNumber] = invoice
+				rl.DocumentID = invoice.SalesInvoiceID
+				rl.OutletID = invoice.OutletID
+				ownerBranchID = invoice.BranchBillingID
 			}
-
-			snapshotAmount := denormFloat(snapshotAmountPtr)
-			snapshotSettlement := denormFloat(snapshotSettlementPtr)
-
-			// INSERT list_outstanding_transfer
-			res, err := tx.Exec(`
-				INSERT INTO list_outstanding_transfer (
-					branch_source_id, branch_destination_id, request_number,
-					transfer_note, requestedAt, requestedBy
-				) VALUES (?, ?, ?, ?, ?, ?)
-			`, branchOriginID, branchDestinationID, transferNumber, transferNote, transferDate, *adminID)
-
-			if err != nil {
-				_ = tx.Rollback()
-				resp.Message = "error inserting outstanding transfer: " + err.Error()
-				goto FINISH
+			if seen[rl.DocumentID] {
+				skippedReport.add(line.Row, transferNumber, line.DocumentNumber, "dokumen ganda dalam transfer")
+				continue
 			}
-			transferID, _ := res.LastInsertId()
-
-			// INSERT rel_outstanding_transfer_transaction
-			_, err = tx.Exec(`
-				INSERT INTO rel_outstanding_transfer_transaction (
-					outstanding_transfer_id, sales_invoice_id, outlet_id,
-					snapshot_amount, snapshot_settlement
-				) VALUES (?, ?, ?, ?, ?)
-			`, transferID, invoice.SalesInvoiceID, invoice.OutletID, snapshotAmount, snapshotSettlement)
+			if ownerBranchID != group.BranchOriginID {
+				skippedReport.add(line.Row, transferNumber, line.DocumentNumber, "dokumen tidak berada di cabang asal")
+				continue
+			}
+			seen[rl.DocumentID] = true
+			lines = append(lines, rl)
+		}
+		if len(lines) == 0 {
+			skippedReport.add(group.Lines[0].Row, transferNumber, nil, "transfer dilewati, tidak ada dokumen valid")
+			continue
+		}
 
+		// INSERT header
+		statusID := TransferStatusRequested
+		var approvedAt, approvedBy interface{}
+		if group.Approved {
+			statusID = TransferStatusApproved
+			approvedAt = group.TransferDate
+			approvedBy = *adminID
+		}
+		res, err := tx.Exec(`
+			INSERT INTO `+headerTable+` (
+				branch_source_id, branch_destination_id, request_number,
+				transfer_note, transfer_status_id, requestedAt, requestedBy, approvedAt, approvedBy
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, group.BranchOriginID, group.BranchDestinationID, transferNumber, group.TransferNote, statusID, group.TransferDate, *adminID, approvedAt, approvedBy)
+		if err != nil {
+			_ = tx.Rollback()
+			resp.Message = "error inserting " + headerTable + ": " + err.Error()
+			goto FINISH
+		}
+		transferID, _ := res.LastInsertId()
+
+		// INSERT lines and move ownership once approved
+		for _, line := range lines {
+			if group.TransferType == TransferTypeDeposit {
+				_, err = tx.Exec(`
+					INSERT INTO rel_deposit_transfer_transaction (deposit_transfer_id, deposit_id)
+					VALUES (?, ?)
+				`, transferID, line.DocumentID)
+				if err == nil && group.Approved {
+					_, err = tx.Exec("UPDATE list_outlet_deposit SET branch_id = ? WHERE deposit_id = ?", group.BranchDestinationID, line.DocumentID)
+				}
+			} else {
+				_, err = tx.Exec(`
+					INSERT INTO rel_outstanding_transfer_transaction (
+						outstanding_transfer_id, sales_invoice_id, outlet_id,
+						snapshot_amount, snapshot_settlement
+					) VALUES (?, ?, ?, ?, ?)
+				`, transferID, line.DocumentID, line.OutletID, line.SnapshotAmount, line.SnapshotSettlement)
+				if err == nil && group.Approved {
+					_, err = tx.Exec("UPDATE list_sales_invoice SET branch_billing_id = ? WHERE sales_invoice_id = ?", group.BranchDestinationID, line.DocumentID)
+				}
+			}
 			if err != nil {
 				_ = tx.Rollback()
-				resp.Message = "error inserting outstanding transfer transaction: " + err.Error()
+				resp.Message = "error inserting " + lineTable + ": " + err.Error()
 				goto FINISH
 			}
-
-			insertedCount++
+			lineCount++
 		}
+
+		insertedCount++
 	}
 
 	// Commit transaction
@@ -314,9 +429,13 @@ func RunImportTransferOutstandingCmd(args []string) {
 		goto FINISH
 	}
 
+	if err := writeReports(*reportPath, skippedReport); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
 	resp.Success = true
 	resp.Message = "Import Transfer Outstanding Success"
-	resp.MessageDetail = fmt.Sprintf("Total %d transfers inserted. Execution Time: %.4fs", insertedCount, time.Since(start).Seconds())
+	resp.MessageDetail = fmt.Sprintf("Total %d transfers inserted with %d lines, %d rows skipped. Execution Time: %.4fs", insertedCount, lineCount, skippedReport.count(), time.Since(start).Seconds())
 
 FINISH:
 	out, _ := json.Marshal(resp)
@@ -324,8 +443,47 @@ FINISH:
 	log.Printf("import transfer outstanding complete: %d transfers, time=%.4fs\n", insertedCount, time.Since(start).Seconds())
 }
 
+// Transfer types (column 7)
+const (
+	TransferTypeDeposit     = "deposit"
+	TransferTypeOutstanding = "outstanding"
+)
+
+// transfer_status_id of list_deposit_transfer / list_outstanding_transfer
+const (
+	TransferStatusRequested = 1
+	TransferStatusApproved  = 2
+)
+
 // Helper struct
 type InvoiceTransferData struct {
-	SalesInvoiceID int64
-	OutletID       int64
+	SalesInvoiceID  int64
+	OutletID        int64
+	BranchBillingID int64
+}
+
+type DepositTransferData struct {
+	DepositID int64
+	BranchID  int64
+}
+
+// TransferGroup is one transfer document built from all rows sharing a
+// transfer number.
+type TransferGroup struct {
+	TransferNumber      string
+	TransferType        string
+	BranchOriginID      int64
+	BranchDestinationID int64
+	TransferDate        interface{}
+	TransferNote        string
+	Approved            bool
+	Conflict            string
+	Lines               []TransferLine
+}
+
+type TransferLine struct {
+	Row                int
+	DocumentNumber     string
+	SnapshotAmount     Money
+	SnapshotSettlement Money
 }
@@ -0,0 +1,100 @@
+package src
+
+import (
+	"database/sql"
+	"time"
+)
+
+// list_settlement.settlement_status_id values
+const (
+	SettlementStatusApproved  = 2
+	SettlementStatusCancelled = 3
+)
+
+// list_outlet_deposit.deposit_type_id values
+const (
+	DepositTypePelunasan = 1
+	DepositTypeRetur     = 3
+)
+
+// list_settlement_group.payment_method_id for a settlement paid from the
+// outlet deposit (1 cash, 2 transfer, 3 giro).
+const PaymentMethodDeposit = 4
+
+// invoicePaidAmount returns what has already been paid on an invoice:
+// active settlements plus deposit credits applied to it outside a
+// settlement (credits booked by a deposit settlement are counted there).
+func invoicePaidAmount(tx *sql.Tx, salesInvoiceID int64) (Money, error) {
+	var settled, deposit Money
+	err := tx.QueryRow(`
+		SELECT COALESCE(SUM(rsi.payment_amount), 0)
+		FROM rel_settle_invoice rsi
+		JOIN list_settlement ls ON ls.settlement_id = rsi.settlement_id
+		WHERE rsi.sales_invoice_id = ? AND ls.settlement_status_id <> ?
+	`, salesInvoiceID, SettlementStatusCancelled).Scan(&settled)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(credit), 0)
+		FROM list_outlet_deposit
+		WHERE sales_invoice_id = ? AND credit > 0 AND settlement_id IS NULL
+	`, salesInvoiceID).Scan(&deposit)
+	if err != nil {
+		return 0, err
+	}
+	return settled + deposit, nil
+}
+
+// outstandingTracker keeps the remaining amount of every invoice touched by
+// an import, so rows that are not yet written (e.g. aggregated giro rows)
+// still count against the invoice.
+type outstandingTracker struct {
+	tx      *sql.Tx
+	left    map[int64]Money
+	numbers map[int64]string
+	order   []int64
+}
+
+func newOutstandingTracker(tx *sql.Tx) *outstandingTracker {
+	return &outstandingTracker{
+		tx:      tx,
+		left:    make(map[int64]Money),
+		numbers: make(map[int64]string),
+	}
+}
+
+// remaining returns the open amount of an invoice, loading it on first use.
+func (t *outstandingTracker) remaining(salesInvoiceID int64, invoiceNumber string, amount Money) (Money, error) {
+	if left, ok := t.left[salesInvoiceID]; ok {
+		return left, nil
+	}
+	paid, err := invoicePaidAmount(t.tx, salesInvoiceID)
+	if err != nil {
+		return 0, err
+	}
+	t.left[salesInvoiceID] = amount - paid
+	t.numbers[salesInvoiceID] = invoiceNumber
+	t.order = append(t.order, salesInvoiceID)
+	return t.left[salesInvoiceID], nil
+}
+
+// apply books a payment against the tracked invoice.
+func (t *outstandingTracker) apply(salesInvoiceID int64, paid Money) {
+	t.left[salesInvoiceID] -= paid
+}
+
+// insertOverpaymentDeposit books the part of a payment above the invoice
+// outstanding as outlet deposit (debit), linked to its settlement.
+func insertOverpaymentDeposit(tx *sql.Tx, depositDate interface{}, depositNumber string, branchID, outletID int64, amount Money, settlementID, salesInvoiceID int64, adminID int) error {
+	_, err := tx.Exec(`
+		INSERT INTO list_outlet_deposit (
+			deposit_date, deposit_number, deposit_type_id, outlet_id,
+			branch_id, deposit_location_id, debit, credit,
+			note, settlement_id, sales_invoice_id, return_invoice_id,
+			createdAt, createdBy
+		) VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?, ?, NULL, ?, ?)
+	`, depositDate, depositNumber, DepositTypePelunasan, outletID, branchID, branchID, amount,
+		"DEPOSIT LEBIH BAYAR", settlementID, salesInvoiceID, time.Now().Format("2006-01-02 15:04:05"), adminID)
+	return err
+}
@@ -0,0 +1,147 @@
+package src
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// RunInvoiceReconcileCmd checks every invoice header against its items,
+// fees and stamp duty, and optionally corrects the header amount.
+func RunInvoiceReconcileCmd(args []string) {
+	fs := flag.NewFlagSet("invoice-reconcile", flag.ExitOnError)
+	dsn := fs.String("dsn", "", "mysql DSN, e.g. user:pass@tcp(127.0.0.1:3306)/dbname?parseTime=true")
+	onlyCodes := fs.String("only-codes", "", "only check these invoice numbers (comma list or file, one per line)")
+	excludeCodes := fs.String("exclude-codes", "", "skip these invoice numbers (comma list or file, one per line)")
+	tolerance := fs.String("tolerance", "1", "allowed difference between computed and recorded invoice total")
+	stampDuty := fs.String("stamp-duty", DefaultStampDutyAmount.String(), "meterai amount for invoices flagged with stamp duty and no Materai fee")
+	rounding := fs.String("rounding", RoundPerDocument, "PPN rounding: line (per item line, summed) or document (once on the invoice DPP)")
+	fix := fs.Bool("fix", false, "set the header amount of mismatching invoices to the recomputed total")
+	reportPath := fs.String("report", "", "path to xlsx report of mismatching invoices (optional)")
+	fs.Parse(args)
+
+	start := time.Now()
+	resp := Response{Success: false}
+	report := newInvoiceReconcileReport()
+	checked := 0
+
+	if *dsn == "" {
+		resp.Message = "dsn is required"
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	toleranceAmount, err := parseMoneyFlag("tolerance", *tolerance)
+	if err != nil {
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	stampDutyAmount, err := parseMoneyFlag("stamp-duty", *stampDuty)
+	if err != nil {
+		resp.Message = err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	if !validRoundingMode(*rounding) {
+		resp.Message = "invalid rounding mode: " + *rounding
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	codes, err := newCodeFilter(*onlyCodes, *excludeCodes)
+	if err != nil {
+		resp.Message = "error reading code list: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("mysql", *dsn)
+	if err != nil {
+		resp.Message = "db open error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		resp.Message = "db begin error: " + err.Error()
+		out, _ := json.Marshal(resp)
+		fmt.Println(string(out))
+		os.Exit(1)
+	}
+
+	ids, err := invoicesWithItems(tx, codes)
+	if err != nil {
+		_ = tx.Rollback()
+		resp.Message = "error querying invoices: " + err.Error()
+		goto FINISH
+	}
+	checked = len(ids)
+
+	if _, err := reconcileInvoices(tx, ids, stampDutyAmount, *rounding, toleranceAmount, *fix, report); err != nil {
+		_ = tx.Rollback()
+		resp.Message = "error reconciling invoice total: " + err.Error()
+		goto FINISH
+	}
+
+	if err := tx.Commit(); err != nil {
+		_ = tx.Rollback()
+		resp.Message = "db commit error: " + err.Error()
+		goto FINISH
+	}
+
+	if err := writeReports(*reportPath, report); err != nil {
+		log.Printf("warning: failed writing report %s: %v\n", *reportPath, err)
+	}
+
+	resp.Success = true
+	resp.Message = "Invoice Reconcile Success"
+	if *fix {
+		resp.MessageDetail = fmt.Sprintf("Total %d invoices checked, %d headers corrected. Execution Time: %.4fs", checked, report.count(), time.Since(start).Seconds())
+	} else {
+		resp.MessageDetail = fmt.Sprintf("Total %d invoices checked, %d not matching. Execution Time: %.4fs", checked, report.count(), time.Since(start).Seconds())
+	}
+
+FINISH:
+	out, _ := json.Marshal(resp)
+	fmt.Println(string(out))
+	log.Printf("invoice reconcile complete: %d invoices, time=%.4fs\n", checked, time.Since(start).Seconds())
+}
+
+// invoicesWithItems lists the invoices that have item lines, filtered by
+// invoice number.
+func invoicesWithItems(tx *sql.Tx, codes *codeFilter) ([]int64, error) {
+	rows, err := tx.Query(`
+		SELECT i.sales_invoice_id, i.sales_invoice_number
+		FROM list_sales_invoice i
+		WHERE EXISTS (SELECT 1 FROM rel_sales_invoice_item it WHERE it.sales_invoice_id = i.sales_invoice_id)
+		ORDER BY i.sales_invoice_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		var number string
+		if err := rows.Scan(&id, &number); err != nil {
+			return nil, err
+		}
+		if codes.allows(number) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
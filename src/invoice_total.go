@@ -0,0 +1,153 @@
+package src
+
+import (
+	"database/sql"
+	"math/big"
+)
+
+// DefaultStampDutyAmount is the meterai charged on invoices flagged with
+// list_sales_invoice.stamp_duty when no Materai fee row carries it.
+const DefaultStampDutyAmount Money = 10000 * moneyScale
+
+// StampDutyFeeName is the list_fee_type name of the meterai fee.
+const StampDutyFeeName = "Materai"
+
+// invoiceTotals recomputes an invoice total from its lines: item net price
+// less cash discount, plus PPN (list_sales_invoice.ppn is the rate), fees
+// and stamp duty. PPN is charged on the item dpp (per unit, DPP nilai lain
+// under a rule with a DPP factor); the factor is read back from the lines
+// so the cash discount is reduced the same way. rounding decides whether
+// PPN is rounded per item line or once on the document DPP.
+func invoiceTotals(tx *sql.Tx, salesInvoiceID int64, stampDutyAmount Money, rounding string) (*InvoiceTotalData, error) {
+	t := &InvoiceTotalData{SalesInvoiceID: salesInvoiceID}
+	var stampDuty int
+	err := tx.QueryRow(`
+		SELECT sales_invoice_number, COALESCE(amount, 0), COALESCE(ppn, 0), COALESCE(cash_discount, 0), COALESCE(stamp_duty, 0)
+		FROM list_sales_invoice
+		WHERE sales_invoice_id = ?
+	`, salesInvoiceID).Scan(&t.InvoiceNumber, &t.Recorded, &t.PPNRate, &t.CashDiscount, &stampDuty)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT COALESCE(quoted_price - discount_value, 0), COALESCE(dpp, 0), COALESCE(qty, 0)
+		FROM rel_sales_invoice_item
+		WHERE sales_invoice_id = ?
+	`, salesInvoiceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var linePPN Money
+	for rows.Next() {
+		var net, dpp Money
+		var qty int64
+		if err := rows.Scan(&net, &dpp, &qty); err != nil {
+			return nil, err
+		}
+		t.ItemCount++
+		t.Items += net.mulInt(qty)
+		t.TaxBase += dpp.mulInt(qty)
+		linePPN += dpp.mulInt(qty).percent(t.PPNRate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var stampFee Money
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(f.amount), 0), COALESCE(SUM(CASE WHEN ft.fee_type_name = ? THEN f.amount ELSE 0 END), 0)
+		FROM rel_sales_invoice_fees f
+		LEFT JOIN list_fee_type ft ON ft.fee_type_id = f.fee_type_id
+		WHERE f.sales_invoice_id = ?
+	`, StampDutyFeeName, salesInvoiceID).Scan(&t.Fees, &stampFee)
+	if err != nil {
+		return nil, err
+	}
+	// a Materai fee row already carries the stamp duty
+	if stampDuty == 1 && stampFee == 0 {
+		t.StampDuty = stampDutyAmount
+	}
+	t.DPPFactor = ratioOne
+	if t.Items != 0 {
+		t.DPPFactor = Ratio{Num: int64(t.TaxBase), Den: int64(t.Items)}
+	}
+	cashDiscountDPP := t.CashDiscount.mulRatio(t.DPPFactor)
+	t.DPP = t.TaxBase - cashDiscountDPP
+	if rounding == RoundPerLine {
+		t.PPN = linePPN - cashDiscountDPP.percent(t.PPNRate)
+	} else {
+		t.PPN = t.DPP.percent(t.PPNRate)
+	}
+	t.Computed = t.Items - t.CashDiscount + t.PPN + t.Fees + t.StampDuty
+	return t, nil
+}
+
+// reconcileInvoices compares the recomputed total of each invoice with its
+// header and reports the ones off by more than tolerance. With fix the
+// header amount is set to the computed total. Invoices without items are
+// left alone, their lines may simply not be imported yet.
+func reconcileInvoices(tx *sql.Tx, salesInvoiceIDs []int64, stampDutyAmount Money, rounding string, tolerance Money, fix bool, report *importReport) (int, error) {
+	mismatched := 0
+	for _, id := range salesInvoiceIDs {
+		t, err := invoiceTotals(tx, id, stampDutyAmount, rounding)
+		if err != nil {
+			return mismatched, err
+		}
+		if t.ItemCount == 0 || t.difference().abs() <= tolerance {
+			continue
+		}
+		mismatched++
+		note := "selisih"
+		if fix {
+			if _, err := tx.Exec("UPDATE list_sales_invoice SET amount = ? WHERE sales_invoice_id = ?", t.Computed, id); err != nil {
+				return mismatched, err
+			}
+			note = "header dikoreksi"
+		}
+		report.add(t.InvoiceNumber, t.DPP, t.headerDPP(), t.PPN, t.headerPPN(), t.Fees, t.StampDuty, t.Computed, t.Recorded, t.difference(), note)
+	}
+	return mismatched, nil
+}
+
+func newInvoiceReconcileReport() *importReport {
+	return newImportReport("Total Invoice", "No Invoice", "DPP Item", "DPP Header", "PPN Item", "PPN Header",
+		"Biaya", "Materai", "Total Hitung", "Total Header", "Selisih", "Keterangan")
+}
+
+// Helper struct
+type InvoiceTotalData struct {
+	SalesInvoiceID int64
+	InvoiceNumber  string
+	ItemCount      int
+	Items          Money
+	TaxBase        Money
+	CashDiscount   Money
+	DPPFactor      Ratio
+	DPP            Money
+	PPNRate        Percent
+	PPN            Money
+	Fees           Money
+	StampDuty      Money
+	Computed       Money
+	Recorded       Money
+}
+
+func (t *InvoiceTotalData) difference() Money {
+	return t.Computed - t.Recorded
+}
+
+// headerDPP derives the DPP the header amount implies, taking fees and
+// stamp duty out and PPN off: base * f / (1 + f * rate / 100).
+func (t *InvoiceTotalData) headerDPP() Money {
+	base := big.NewInt(int64(t.Recorded - t.Fees - t.StampDuty))
+	num := new(big.Int).Mul(big.NewInt(t.DPPFactor.Num), big.NewInt(100*percentScale))
+	den := new(big.Int).Mul(big.NewInt(t.DPPFactor.Den), big.NewInt(100*percentScale))
+	den.Add(den, new(big.Int).Mul(big.NewInt(t.DPPFactor.Num), big.NewInt(int64(t.PPNRate))))
+	return Money(quoRound(num.Mul(num, base), den))
+}
+
+func (t *InvoiceTotalData) headerPPN() Money {
+	return t.headerDPP().percent(t.PPNRate)
+}
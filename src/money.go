@@ -0,0 +1,311 @@
+package src
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money is an amount in sen (1/100 rupiah). Amounts are parsed, added and
+// compared as integers so totals do not drift the way float64 sums do; the
+// only rounding happens where a percentage or ratio is applied.
+type Money int64
+
+// Percent is a percentage with four decimals (2.5% = 25000), used for
+// discounts and PPN rates.
+type Percent int64
+
+const (
+	moneyScale   = 100
+	percentScale = 10000
+)
+
+// Rounding of PPN, matching the web app: discounts and DPP are always
+// rounded to sen per item line; PPN is either computed per line and summed,
+// or computed once on the document DPP.
+const (
+	RoundPerLine     = "line"
+	RoundPerDocument = "document"
+)
+
+func validRoundingMode(mode string) bool {
+	return mode == RoundPerLine || mode == RoundPerDocument
+}
+
+// parseDecimal reads a plain decimal string ("-1234.567") as an integer
+// with the given number of decimals, rounding half away from zero.
+func parseDecimal(s string, decimals int) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" {
+		intPart = "0"
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		// e.g. "1.5E+07" from a formatted cell
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("angka tidak valid: %s", s)
+		}
+		v := int64(math.Round(f * math.Pow10(decimals)))
+		if neg {
+			v = -v
+		}
+		return v, nil
+	}
+
+	roundUp := false
+	if len(fracPart) > decimals {
+		roundUp = fracPart[decimals] >= '5'
+		fracPart = fracPart[:decimals]
+	}
+	fracPart += strings.Repeat("0", decimals-len(fracPart))
+	v, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("angka tidak valid: %s", s)
+	}
+	if roundUp {
+		v++
+	}
+	if neg {
+		v = -v
+	}
+	return v, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMoney reads an amount already in plain decimal notation.
+func parseMoney(s string) (Money, error) {
+	v, err := parseDecimal(s, 2)
+	return Money(v), err
+}
+
+// denormMoney is the Money counterpart of denormFloat: it accepts the same
+// cell formats and gives 0 for empty or invalid cells.
+func denormMoney(val *string) Money {
+	if val == nil {
+		return 0
+	}
+	m, err := parseMoney(normalizeDecimal(*val))
+	if err != nil {
+		return 0
+	}
+	return m
+}
+
+// denormPercent reads a percentage cell ("2,5", "2.5%") like denormMoney.
+func denormPercent(val *string) Percent {
+	if val == nil {
+		return 0
+	}
+	v, err := parseDecimal(normalizeDecimal(strings.TrimSuffix(strings.TrimSpace(*val), "%")), 4)
+	if err != nil {
+		return 0
+	}
+	return Percent(v)
+}
+
+// parseMoneyFlag reads an amount flag such as --tolerance as an exact
+// decimal; negative amounts are rejected.
+func parseMoneyFlag(name, value string) (Money, error) {
+	m, err := parseMoney(value)
+	if err != nil || m < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return m, nil
+}
+
+// moneyFromFloat converts a float amount (flags, legacy values), rounding
+// to the nearest sen.
+func moneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyScale))
+}
+
+func percentFromFloat(f float64) Percent {
+	return Percent(math.Round(f * percentScale))
+}
+
+// mulDivRound returns a*b/c rounded half away from zero without overflowing
+// on large amounts.
+func mulDivRound(a, b, c int64) int64 {
+	return quoRound(new(big.Int).Mul(big.NewInt(a), big.NewInt(b)), big.NewInt(c))
+}
+
+// quoRound returns n/d rounded half away from zero.
+func quoRound(n, d *big.Int) int64 {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	// |2r| >= |d| means the remainder is at least half
+	r.Abs(r).Mul(r, big.NewInt(2))
+	if r.Cmp(new(big.Int).Abs(d)) >= 0 {
+		if n.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q.Int64()
+}
+
+// percent returns p percent of m, rounded to sen.
+func (m Money) percent(p Percent) Money {
+	return Money(mulDivRound(int64(m), int64(p), 100*percentScale))
+}
+
+// mulRatio returns m*r, rounded to sen.
+func (m Money) mulRatio(r Ratio) Money {
+	return Money(mulDivRound(int64(m), r.Num, r.Den))
+}
+
+func (m Money) mulInt(n int64) Money {
+	return m * Money(n)
+}
+
+func (m Money) abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+func minMoney(a, b Money) Money {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxMoney(a, b Money) Money {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+// String formats the amount as a plain decimal ("-1234.50").
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/moneyScale, v%moneyScale)
+}
+
+// Value binds the amount as an exact decimal string.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// Scan reads DECIMAL columns (returned as []byte by the mysql driver) and
+// integer or float columns.
+func (m *Money) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+	case []byte:
+		return m.scanString(string(v))
+	case string:
+		return m.scanString(v)
+	case int64:
+		*m = Money(v * moneyScale)
+	case float64:
+		*m = moneyFromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+	return nil
+}
+
+func (m *Money) scanString(s string) error {
+	v, err := parseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func (p Percent) Float64() float64 {
+	return float64(p) / percentScale
+}
+
+// String formats the percentage without trailing zeros ("11", "2.5").
+func (p Percent) String() string {
+	return strconv.FormatFloat(p.Float64(), 'f', -1, 64)
+}
+
+func (p Percent) Value() (driver.Value, error) {
+	return p.String(), nil
+}
+
+func (p *Percent) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*p = 0
+	case []byte:
+		n, err := parseDecimal(string(v), 4)
+		*p = Percent(n)
+		return err
+	case string:
+		n, err := parseDecimal(v, 4)
+		*p = Percent(n)
+		return err
+	case int64:
+		*p = Percent(v * percentScale)
+	case float64:
+		*p = percentFromFloat(v)
+	default:
+		return fmt.Errorf("cannot scan %T into Percent", src)
+	}
+	return nil
+}
+
+// Ratio is an exact fraction such as the 11/12 DPP nilai lain factor.
+type Ratio struct {
+	Num int64
+	Den int64
+}
+
+var ratioOne = Ratio{Num: 1, Den: 1}
+
+func (r Ratio) Float64() float64 {
+	return float64(r.Num) / float64(r.Den)
+}
+
+// String writes the ratio as "11/12", or "1" for the full price.
+func (r Ratio) String() string {
+	if r.isOne() {
+		return "1"
+	}
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+func (r Ratio) isOne() bool {
+	return r.Num == r.Den
+}
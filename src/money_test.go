@@ -0,0 +1,181 @@
+package src
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		raw      string
+		decimals int
+		want     int64
+		wantErr  bool
+	}{
+		{"", 2, 0, false},
+		{"1234.5", 2, 123450, false},
+		{"1234.565", 2, 123457, false},
+		{"1234.564", 2, 123456, false},
+		{"0.005", 2, 1, false},
+		{"-0.005", 2, -1, false},
+		{"-1234.565", 2, -123457, false},
+		{"+12", 2, 1200, false},
+		{".5", 2, 50, false},
+		{"1.5E+07", 2, 1500000000, false},
+		{"-2.5e2", 2, -25000, false},
+		{"2.5", 4, 25000, false},
+		{"0.91666", 4, 9167, false},
+		{"1,5", 2, 0, true},
+		{"abc", 2, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseDecimal(tt.raw, tt.decimals)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseDecimal(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("parseDecimal(%q, %d) = %d, want %d", tt.raw, tt.decimals, got, tt.want)
+		}
+	}
+}
+
+func TestDenormMoney(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want Money
+	}{
+		{"1.234,56", 123456},
+		{"1,234.56", 123456},
+		{"12,5", 1250},
+		{"-0,005", -1},
+		{"10.999", 1100},
+		{"1.5E+07", 1500000000},
+		{"-", 0},
+	}
+	for _, tt := range tests {
+		raw := tt.raw
+		if got := denormMoney(&raw); got != tt.want {
+			t.Errorf("denormMoney(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestQuoRound(t *testing.T) {
+	tests := []struct {
+		n, d int64
+		want int64
+	}{
+		{5, 2, 3},
+		{-5, 2, -3},
+		{5, -2, -3},
+		{-5, -2, 3},
+		{7, 3, 2},
+		{-7, 3, -2},
+		{-8, 3, -3},
+		{0, 3, 0},
+	}
+	for _, tt := range tests {
+		if got := quoRound(big.NewInt(tt.n), big.NewInt(tt.d)); got != tt.want {
+			t.Errorf("quoRound(%d, %d) = %d, want %d", tt.n, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyPercentAndRatio(t *testing.T) {
+	dpp := Ratio{Num: 11, Den: 12}
+	tests := []struct {
+		name string
+		got  Money
+		want Money
+	}{
+		{"11% of 100.00", Money(10000).percent(11 * percentScale), 1100},
+		{"2.5% rounds half up", Money(1).percent(50 * percentScale), 1},
+		{"2.5% of a negative rounds away from zero", Money(-1).percent(50 * percentScale), -1},
+		{"12% of 1,000,000.00", Money(100000000).percent(12 * percentScale), 12000000},
+		{"11/12 of 1,200.00", Money(120000).mulRatio(dpp), 110000},
+		{"11/12 of 1,000.00", Money(100000).mulRatio(dpp), 91667},
+		{"11/12 of -1,000.00", Money(-100000).mulRatio(dpp), -91667},
+		{"12% on 11/12 equals 11%", Money(100000).mulRatio(dpp).percent(12 * percentScale), 11000},
+		{"full price", Money(12345).mulRatio(ratioOne), 12345},
+		{"no overflow on large amounts", Money(900000000000000).percent(12 * percentScale), 108000000000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %d, want %d", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{123450, "1234.50"},
+		{-5, "-0.05"},
+		{-123450, "-1234.50"},
+		{0, "0.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.m), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     interface{}
+		want    Money
+		wantErr bool
+	}{
+		{"decimal", []byte("1234.56"), 123456, false},
+		{"negative decimal", []byte("-0.50"), -50, false},
+		{"decimal with more places", []byte("10.005"), 1001, false},
+		{"string", "99.9", 9990, false},
+		{"int", int64(1500), 150000, false},
+		{"float", 12.345, 1235, false},
+		{"null", nil, 0, false},
+		{"bool", true, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var m Money
+			err := m.Scan(tt.src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Scan error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if m != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, m, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  interface{}
+		want Percent
+	}{
+		{"decimal", []byte("11.00"), 11 * percentScale},
+		{"fraction", []byte("2.5"), 25000},
+		{"int", int64(12), 12 * percentScale},
+		{"float", 0.5, 5000},
+		{"null", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Percent
+			if err := p.Scan(tt.src); err != nil {
+				t.Fatalf("Scan error = %v", err)
+			}
+			if p != tt.want {
+				t.Errorf("Scan(%v) = %d, want %d", tt.src, p, tt.want)
+			}
+		})
+	}
+}
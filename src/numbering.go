@@ -0,0 +1,181 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Document codes accepted by --numbering-format
+const (
+	DocDebtCollectionDraft = "DTH_DRAFT"
+	DocDebtCollection      = "DTH"
+	DocCashierReceipt      = "CR"
+	DocSettlementDraft     = "STL_DRAFT"
+	DocSettlement          = "STL"
+	DocSTB                 = "STB"
+)
+
+// documentNumberTarget says where a document number is stored, so the
+// sequence can continue after the numbers the app already handed out.
+type documentNumberTarget struct {
+	Table  string
+	Column string
+}
+
+var documentNumberTargets = map[string]documentNumberTarget{
+	DocDebtCollectionDraft: {"list_debt_collection", "debt_collection_draft_number"},
+	DocDebtCollection:      {"list_debt_collection", "debt_collection_number"},
+	DocCashierReceipt:      {"list_cashier_receipt", "cashier_receipt_number"},
+	DocSettlementDraft:     {"list_settlement", "settlement_draft_number"},
+	DocSettlement:          {"list_settlement", "settlement_number"},
+	DocSTB:                 {"list_stb", "stb_number"},
+}
+
+// numberingService allocates document numbers in the format the app uses,
+// given per document code with --numbering-format: a prefix with {BRANCH},
+// {YYYY}, {YY} and {MM}, then one '#' per sequence digit, e.g.
+// DTH=DTH/{BRANCH}/{YY}{MM}/#####. The importer does not guess formats; a
+// document without one is an error. The sequence restarts every prefix
+// (so every month when the prefix has {MM}) and continues after the highest
+// number already stored, which is locked for the rest of the transaction.
+type numberingService struct {
+	tx          *sql.Tx
+	formats     map[string]NumberingFormat
+	branchCodes map[int64]string
+	sequences   map[string]int64
+}
+
+// newNumberingService takes the formats read by parseNumberingFormats.
+func newNumberingService(tx *sql.Tx, formats map[string]NumberingFormat) *numberingService {
+	return &numberingService{
+		tx:          tx,
+		formats:     formats,
+		branchCodes: make(map[int64]string),
+		sequences:   make(map[string]int64),
+	}
+}
+
+// parseNumberingFormats reads document_code=format pairs and checks that
+// every code in required has a format.
+func parseNumberingFormats(pairs map[string]string, required ...string) (map[string]NumberingFormat, error) {
+	formats := map[string]NumberingFormat{}
+	for code, value := range pairs {
+		if _, ok := documentNumberTargets[code]; !ok {
+			return nil, fmt.Errorf("unknown document code %s", code)
+		}
+		prefix := strings.TrimRight(value, "#")
+		digits := len(value) - len(prefix)
+		if prefix == "" || digits == 0 {
+			return nil, fmt.Errorf("format of %s needs a prefix and one '#' per sequence digit: %s", code, value)
+		}
+		formats[code] = NumberingFormat{Format: prefix, Digits: digits}
+	}
+	for _, code := range required {
+		if _, ok := formats[code]; !ok {
+			return nil, fmt.Errorf("no format for %s", code)
+		}
+	}
+	return formats, nil
+}
+
+func (n *numberingService) branchCode(branchID int64) (string, error) {
+	if c, ok := n.branchCodes[branchID]; ok {
+		return c, nil
+	}
+	var code sql.NullString
+	err := n.tx.QueryRow("SELECT branch_code FROM list_branch WHERE branch_id = ? LIMIT 1", branchID).Scan(&code)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if code.String == "" {
+		return "", fmt.Errorf("branch %d has no branch_code", branchID)
+	}
+	n.branchCodes[branchID] = code.String
+	return code.String, nil
+}
+
+// renderPrefix fills {BRANCH}, {YYYY}, {YY} and {MM} in a number format.
+func renderPrefix(format, branchCode string, date time.Time) string {
+	return strings.NewReplacer(
+		"{BRANCH}", branchCode,
+		"{YYYY}", date.Format("2006"),
+		"{YY}", date.Format("06"),
+		"{MM}", date.Format("01"),
+	).Replace(format)
+}
+
+// next allocates the next number of a document for a branch and document
+// date.
+func (n *numberingService) next(docCode string, branchID int64, date time.Time) (string, error) {
+	f, ok := n.formats[docCode]
+	if !ok {
+		return "", fmt.Errorf("no numbering format configured for %s", docCode)
+	}
+	branchCode, err := n.branchCode(branchID)
+	if err != nil {
+		return "", err
+	}
+	prefix := renderPrefix(f.Format, branchCode, date)
+	key := docCode + "|" + prefix
+	last, ok := n.sequences[key]
+	if !ok {
+		last, err = n.lastUsedSequence(docCode, prefix)
+		if err != nil {
+			return "", err
+		}
+	}
+	last++
+	n.sequences[key] = last
+	return fmt.Sprintf("%s%0*d", prefix, f.Digits, last), nil
+}
+
+// lastUsedSequence reads the highest sequence already used with prefix in
+// the document table. The matching rows are locked so a concurrent import
+// cannot take the same number. A stored number whose suffix is not a
+// sequence means the format does not match the app's; that is an error
+// rather than a restart at 1, which would hand out duplicates.
+func (n *numberingService) lastUsedSequence(docCode, prefix string) (int64, error) {
+	target := documentNumberTargets[docCode]
+	var number sql.NullString
+	q := fmt.Sprintf("SELECT `%s` FROM `%s` WHERE `%s` LIKE ? ORDER BY LENGTH(`%s`) DESC, `%s` DESC LIMIT 1 FOR UPDATE",
+		target.Column, target.Table, target.Column, target.Column, target.Column)
+	err := n.tx.QueryRow(q, escapeLike(prefix)+"%").Scan(&number)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	seq, err := strconv.ParseInt(strings.TrimPrefix(number.String, prefix), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s %s does not end in a sequence after %s, check --numbering-format", target.Column, number.String, prefix)
+	}
+	return seq, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s; a prefix such as "STL_01/" must
+// not match "STLX01/".
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// numberingDate turns a parsed SQL date (or nil) into the document date used
+// for the prefix and period.
+func numberingDate(v interface{}) time.Time {
+	if s, ok := v.(string); ok {
+		if t, err := time.Parse("2006-01-02", s); err == nil {
+			return t
+		}
+	}
+	return time.Now()
+}
+
+// Helper struct
+
+type NumberingFormat struct {
+	Format string
+	Digits int
+}
@@ -0,0 +1,39 @@
+package src
+
+import "testing"
+
+func TestParseNumberingFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		pairs    map[string]string
+		required []string
+		want     map[string]NumberingFormat
+		wantErr  bool
+	}{
+		{"format with digits", map[string]string{"DTH": "DTH/{BRANCH}/{YY}{MM}/#####"}, []string{DocDebtCollection},
+			map[string]NumberingFormat{"DTH": {Format: "DTH/{BRANCH}/{YY}{MM}/", Digits: 5}}, false},
+		{"missing required", map[string]string{"DTH": "DTH/#####"}, []string{DocDebtCollection, DocSettlement}, nil, true},
+		{"no digits", map[string]string{"DTH": "DTH/{BRANCH}/"}, nil, nil, true},
+		{"digits only", map[string]string{"DTH": "####"}, nil, nil, true},
+		{"unknown code", map[string]string{"XYZ": "XYZ/###"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNumberingFormats(tt.pairs, tt.required...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNumberingFormats error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for code, want := range tt.want {
+				if got[code] != want {
+					t.Errorf("format %s = %+v, want %+v", code, got[code], want)
+				}
+			}
+		})
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`STL_01/10%\`); got != `STL\_01/10\%\\` {
+		t.Errorf("escapeLike = %q", got)
+	}
+}
@@ -0,0 +1,312 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outlet address types (list_outlet_address.address_type_id)
+const (
+	OutletAddressBilling  = 1 // penagihan
+	OutletAddressShipping = 2 // pengiriman
+)
+
+// Sheet holding extra outlet addresses, one row per outlet and address type.
+const OutletAddressSheet = "Alamat Outlet"
+
+// parseOutletAddressType maps the address type cell. An empty or unknown
+// label gives 0; the address is then reported instead of guessed.
+func parseOutletAddressType(v string) int {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "penagihan", "tagihan", "billing":
+		return OutletAddressBilling
+	case "pengiriman", "kirim", "shipping", "delivery":
+		return OutletAddressShipping
+	}
+	return 0
+}
+
+// readOutletAddress reads seven address cells starting at column first:
+// alamat, kelurahan, kecamatan, kota, kode pos, telepon, GPS ("lat, long").
+// It returns nil when all of them are empty. The caller sets the type.
+func readOutletAddress(getCol func(int) *string, first int) *OutletAddressData {
+	a := &OutletAddressData{
+		Address:    getString(getCol(first)),
+		Village:    getString(getCol(first + 1)),
+		District:   getString(getCol(first + 2)),
+		Town:       getString(getCol(first + 3)),
+		PostalCode: getString(getCol(first + 4)),
+		Phone:      getString(getCol(first + 5)),
+		GPS:        getString(getCol(first + 6)),
+	}
+	if a.Address == "" && a.Village == "" && a.District == "" && a.Town == "" && a.PostalCode == "" && a.Phone == "" && a.GPS == "" {
+		return nil
+	}
+	return a
+}
+
+// normalizeTownName lowercases a town name and drops punctuation and the
+// administrative prefix, so "KAB. BOGOR" and "Bogor" compare equal.
+func normalizeTownName(name string) string {
+	n := strings.ToLower(strings.TrimSpace(name))
+	n = strings.NewReplacer(".", " ", ",", " ", "-", " ").Replace(n)
+	fields := strings.Fields(n)
+	if len(fields) > 1 {
+		switch fields[0] {
+		case "kota", "kabupaten", "kab", "kotamadya", "kotif":
+			fields = fields[1:]
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// townResolver matches town names against list_town by normalised name.
+// The table is loaded once per import.
+type townResolver struct {
+	loaded bool
+	byName map[string][]townCandidate
+}
+
+type townCandidate struct {
+	ID   int64
+	Name string
+}
+
+func (r *townResolver) load(tx *sql.Tx) error {
+	r.byName = map[string][]townCandidate{}
+	rows, err := tx.Query("SELECT town_id, town_name FROM list_town")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c townCandidate
+		var name sql.NullString
+		if err := rows.Scan(&c.ID, &name); err != nil {
+			return err
+		}
+		c.Name = name.String
+		key := normalizeTownName(c.Name)
+		r.byName[key] = append(r.byName[key], c)
+	}
+	r.loaded = true
+	return rows.Err()
+}
+
+// resolve returns the town_id for name. When the name is unknown or matches
+// more than one town (e.g. Kota and Kabupaten Bogor) the id is NULL and the
+// reason says why.
+func (r *townResolver) resolve(tx *sql.Tx, name string) (sql.NullInt64, string, error) {
+	if name == "" {
+		return sql.NullInt64{}, "", nil
+	}
+	if !r.loaded {
+		if err := r.load(tx); err != nil {
+			return sql.NullInt64{}, "", err
+		}
+	}
+	id, reason := pickTown(r.byName[normalizeTownName(name)], name)
+	return id, reason, nil
+}
+
+// findTownID resolves a single town name without loading list_town, for
+// lookups outside an outlet import (checkImportColumn).
+func findTownID(tx *sql.Tx, name string) (sql.NullInt64, string, error) {
+	key := normalizeTownName(name)
+	if key == "" {
+		return sql.NullInt64{}, "", nil
+	}
+	rows, err := tx.Query("SELECT town_id, town_name FROM list_town WHERE town_name LIKE ?", "%"+key+"%")
+	if err != nil {
+		return sql.NullInt64{}, "", err
+	}
+	defer rows.Close()
+	candidates := []townCandidate{}
+	for rows.Next() {
+		var c townCandidate
+		var townName sql.NullString
+		if err := rows.Scan(&c.ID, &townName); err != nil {
+			return sql.NullInt64{}, "", err
+		}
+		c.Name = townName.String
+		if normalizeTownName(c.Name) == key {
+			candidates = append(candidates, c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return sql.NullInt64{}, "", err
+	}
+	id, reason := pickTown(candidates, name)
+	return id, reason, nil
+}
+
+// pickTown settles the towns whose normalised name matches name.
+func pickTown(candidates []townCandidate, name string) (sql.NullInt64, string) {
+	switch len(candidates) {
+	case 0:
+		return sql.NullInt64{}, "kota tidak ditemukan"
+	case 1:
+		return sql.NullInt64{Int64: candidates[0].ID, Valid: true}, ""
+	}
+	// an exact full name (with prefix) settles the ambiguity
+	full := strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	names := []string{}
+	for _, c := range candidates {
+		if strings.Join(strings.Fields(strings.ToLower(c.Name)), " ") == full {
+			return sql.NullInt64{Int64: c.ID, Valid: true}, ""
+		}
+		names = append(names, c.Name)
+	}
+	return sql.NullInt64{}, "kota ambigu: " + strings.Join(names, ", ")
+}
+
+// parseGPS reads "lat, long" (comma or space separated). Empty input is
+// valid and gives NULLs.
+func parseGPS(v string) (interface{}, interface{}, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return nil, nil, true
+	}
+	parts := strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' || r == ';' })
+	if len(parts) != 2 {
+		return nil, nil, false
+	}
+	lat, err1 := strconv.ParseFloat(parts[0], 64)
+	lng, err2 := strconv.ParseFloat(parts[1], 64)
+	if err1 != nil || err2 != nil || lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil, nil, false
+	}
+	return lat, lng, true
+}
+
+// normalizePhone keeps digits and a leading plus sign.
+func normalizePhone(v string) string {
+	b := strings.Builder{}
+	for i, r := range strings.TrimSpace(v) {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// importOutletAddresses writes the collected addresses once all outlets are
+// in list_outlet. An outlet keeps one address per type: an existing address
+// of the same type is updated, otherwise a new one is inserted. On update
+// only filled cells are written, unless blankClears is set.
+func importOutletAddresses(tx *sql.Tx, addresses []*OutletAddressData, towns *townResolver, blankClears bool, adminID int, report *importReport) (int, error) {
+	saved := 0
+	outletIDs := map[string]int64{}
+	seen := map[string]bool{}
+
+	for _, a := range addresses {
+		if a.OutletCode == "" {
+			report.add(a.Source, a.OutletCode, a.Town, "kode outlet kosong")
+			continue
+		}
+		if a.TypeID == 0 {
+			report.add(a.Source, a.OutletCode, a.Town, "tipe alamat kosong / tidak dikenal, alamat dilewati")
+			continue
+		}
+		key := fmt.Sprintf("%s|%d", a.OutletCode, a.TypeID)
+		if seen[key] {
+			report.add(a.Source, a.OutletCode, a.Town, "duplikat tipe alamat, dilewati")
+			continue
+		}
+		seen[key] = true
+
+		outletID, ok := outletIDs[a.OutletCode]
+		if !ok {
+			err := tx.QueryRow("SELECT outlet_id FROM list_outlet WHERE outlet_code = ? LIMIT 1", a.OutletCode).Scan(&outletID)
+			if err == sql.ErrNoRows {
+				report.add(a.Source, a.OutletCode, a.Town, "outlet tidak ditemukan")
+				continue
+			}
+			if err != nil {
+				return saved, err
+			}
+			outletIDs[a.OutletCode] = outletID
+		}
+
+		townID, reason, err := towns.resolve(tx, a.Town)
+		if err != nil {
+			return saved, err
+		}
+		if reason != "" {
+			report.add(a.Source, a.OutletCode, a.Town, reason)
+		}
+		lat, lng, ok := parseGPS(a.GPS)
+		if !ok {
+			report.add(a.Source, a.OutletCode, a.Town, "format GPS tidak valid: "+a.GPS)
+		}
+		var town interface{}
+		if townID.Valid {
+			town = townID.Int64
+		}
+		now := time.Now().Format("2006-01-02 15:04:05")
+
+		var addressID int64
+		err = tx.QueryRow("SELECT outlet_address_id FROM list_outlet_address WHERE outlet_id = ? AND address_type_id = ? LIMIT 1", outletID, a.TypeID).Scan(&addressID)
+		switch {
+		case err == sql.ErrNoRows:
+			_, err = tx.Exec(`INSERT INTO list_outlet_address
+				(outlet_id, address_type_id, address, village, district, town_id, postal_code, phone, latitude, longitude, createdAt, createdBy)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				outletID, a.TypeID, a.Address, a.Village, a.District, town, a.PostalCode, normalizePhone(a.Phone), lat, lng, now, adminID)
+		case err == nil:
+			sets := []string{}
+			args := []interface{}{}
+			set := func(col string, cell string, v interface{}) {
+				if cell == "" {
+					if !blankClears {
+						return
+					}
+					v = nil
+				}
+				sets = append(sets, col+" = ?")
+				args = append(args, v)
+			}
+			set("address", a.Address, a.Address)
+			set("village", a.Village, a.Village)
+			set("district", a.District, a.District)
+			// an unresolved town keeps the current one; it is reported above
+			if a.Town == "" || townID.Valid {
+				set("town_id", a.Town, town)
+			}
+			set("postal_code", a.PostalCode, a.PostalCode)
+			set("phone", a.Phone, normalizePhone(a.Phone))
+			if a.GPS == "" || lat != nil {
+				set("latitude", a.GPS, lat)
+				set("longitude", a.GPS, lng)
+			}
+			if len(sets) == 0 {
+				break
+			}
+			args = append(args, addressID)
+			_, err = tx.Exec("UPDATE list_outlet_address SET "+strings.Join(sets, ", ")+" WHERE outlet_address_id = ?", args...)
+		}
+		if err != nil {
+			return saved, fmt.Errorf("error saving address for outlet %s: %w", a.OutletCode, err)
+		}
+		saved++
+	}
+	return saved, nil
+}
+
+// Helper struct
+
+type OutletAddressData struct {
+	Source     string // sheet row, for the report
+	OutletCode string
+	TypeID     int
+	Address    string
+	Village    string
+	District   string
+	Town       string
+	PostalCode string
+	Phone      string
+	GPS        string
+}
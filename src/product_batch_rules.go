@@ -0,0 +1,152 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Batch check modes for the --batch-check flag
+const (
+	BatchCheckEnforce = "enforce" // report and skip violating rows
+	BatchCheckWarn    = "warn"    // report only, import the row anyway
+	BatchCheckOff     = "off"
+)
+
+// ProductBatchRule holds the list_product flags that govern batch and
+// expiry input. expired_threshold is in days.
+type ProductBatchRule struct {
+	NeedExpired      bool
+	RequiredSerial   bool
+	ExpiredThreshold int64
+}
+
+// batchExpiryValidator checks batch number and expiry date cells against the
+// product master. It remembers the expiry of every product+batch it has seen
+// (in this file or already in list_product_batch) so the same batch cannot
+// come in with two different expiry dates.
+type batchExpiryValidator struct {
+	mode     string
+	checkAge bool
+	asOf     time.Time
+	rules    map[int64]*ProductBatchRule
+	seen     map[string]string
+	report   *importReport
+	skipped  int // rows refused in enforce mode
+}
+
+// newBatchExpiryValidator builds a validator. checkAge rejects batches that
+// are already expired, or expire within the product threshold, at asOf;
+// it is meant for opening stock.
+func newBatchExpiryValidator(mode string, checkAge bool, asOf time.Time) *batchExpiryValidator {
+	if mode == "" {
+		mode = BatchCheckWarn
+	}
+	return &batchExpiryValidator{
+		mode:     mode,
+		checkAge: checkAge,
+		asOf:     asOf,
+		rules:    make(map[int64]*ProductBatchRule),
+		seen:     make(map[string]string),
+		report:   newImportReport("Batch Expired", "Baris", "Kode Produk", "Batch", "Expired", "Keterangan"),
+	}
+}
+
+func validBatchCheckMode(mode string) bool {
+	return mode == BatchCheckEnforce || mode == BatchCheckWarn || mode == BatchCheckOff
+}
+
+func (v *batchExpiryValidator) rule(tx *sql.Tx, productID int64) (*ProductBatchRule, error) {
+	if r, ok := v.rules[productID]; ok {
+		return r, nil
+	}
+	var needExpired, requiredSerial sql.NullInt64
+	var threshold sql.NullString
+	err := tx.QueryRow("SELECT is_need_expired, required_serial_number, expired_threshold FROM list_product WHERE product_id = ? LIMIT 1", productID).
+		Scan(&needExpired, &requiredSerial, &threshold)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	r := &ProductBatchRule{
+		NeedExpired:    needExpired.Int64 == 1,
+		RequiredSerial: requiredSerial.Int64 == 1,
+	}
+	if threshold.Valid {
+		r.ExpiredThreshold = denormInt(&threshold.String)
+	}
+	v.rules[productID] = r
+	return r, nil
+}
+
+// validate returns the parsed expiry date for the row and whether the row may
+// be imported. Every violation is written to the validator's report.
+func (v *batchExpiryValidator) validate(tx *sql.Tx, row int, productCode string, productID int64, batchNumber string, expiredCell *string) (interface{}, bool, error) {
+	expiredDate, parsed := parseDateStrict(expiredCell)
+	if v.mode == BatchCheckOff {
+		return expiredDate, true, nil
+	}
+
+	rule, err := v.rule(tx, productID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	reasons := []string{}
+	if !parsed {
+		reasons = append(reasons, "format tanggal expired tidak valid")
+	}
+	if batchNumber == "" && (rule.RequiredSerial || rule.NeedExpired) {
+		reasons = append(reasons, "batch wajib diisi")
+	}
+	if expiredDate == nil && parsed && rule.NeedExpired {
+		reasons = append(reasons, "tanggal expired wajib diisi")
+	}
+
+	if expiredDate != nil {
+		expiredStr := expiredDate.(string)
+
+		if v.checkAge {
+			exp, _ := time.Parse("2006-01-02", expiredStr)
+			if exp.Before(v.asOf) {
+				reasons = append(reasons, "batch sudah expired")
+			} else if rule.ExpiredThreshold > 0 && exp.Before(v.asOf.AddDate(0, 0, int(rule.ExpiredThreshold))) {
+				reasons = append(reasons, fmt.Sprintf("expired dalam threshold %d hari", rule.ExpiredThreshold))
+			}
+		}
+
+		if batchNumber != "" {
+			key := fmt.Sprintf("%d|%s", productID, batchNumber)
+			known, ok := v.seen[key]
+			if !ok {
+				var existing sql.NullString
+				err := tx.QueryRow("SELECT DATE_FORMAT(expired_date, '%Y-%m-%d') FROM list_product_batch WHERE product_id = ? AND batch_number = ? AND expired_date IS NOT NULL LIMIT 1",
+					productID, batchNumber).Scan(&existing)
+				if err != nil && err != sql.ErrNoRows {
+					return nil, false, err
+				}
+				known = existing.String
+			}
+			if known != "" && known != expiredStr {
+				reasons = append(reasons, fmt.Sprintf("expired berbeda dengan batch yang sama (%s)", known))
+			} else {
+				v.seen[key] = expiredStr
+			}
+		}
+	}
+
+	if len(reasons) == 0 {
+		return expiredDate, true, nil
+	}
+
+	shownExpired := ""
+	if expiredCell != nil {
+		shownExpired = *expiredCell
+	}
+	v.report.add(row, productCode, batchNumber, shownExpired, strings.Join(reasons, "; "))
+	if v.mode == BatchCheckEnforce {
+		v.skipped++
+		return expiredDate, false, nil
+	}
+	return expiredDate, true, nil
+}
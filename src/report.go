@@ -0,0 +1,94 @@
+package src
+
+import (
+	"fmt"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// importReport collects rows that need a human look after an import
+// (skipped, mismatched, corrected). Every importer that reports problems
+// keeps one per concern and writes them all with writeReports.
+type importReport struct {
+	sheet   string
+	headers []string
+	rows    [][]interface{}
+}
+
+func newImportReport(sheet string, headers ...string) *importReport {
+	return &importReport{sheet: sheet, headers: headers}
+}
+
+// add appends a row. Money and Percent values are written as their exact
+// decimal string, not through float64.
+func (r *importReport) add(values ...interface{}) {
+	for i, v := range values {
+		switch x := v.(type) {
+		case Money:
+			values[i] = x.String()
+		case Percent:
+			values[i] = x.String()
+		}
+	}
+	r.rows = append(r.rows, values)
+}
+
+func (r *importReport) count() int {
+	return len(r.rows)
+}
+
+// summary returns a one line count for the response message_detail.
+func (r *importReport) summary() string {
+	return fmt.Sprintf("%s: %d baris", r.sheet, len(r.rows))
+}
+
+// writeReports writes each report into its own sheet of an xlsx file.
+// Nothing is written when path is empty or all reports are empty.
+func writeReports(path string, reports ...*importReport) error {
+	if path == "" {
+		return nil
+	}
+	total := 0
+	for _, r := range reports {
+		total += r.count()
+	}
+	if total == 0 {
+		return nil
+	}
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	defaultSheet := f.GetSheetName(0)
+	first := true
+	for _, r := range reports {
+		if r.count() == 0 {
+			continue
+		}
+		if first {
+			if err := f.SetSheetName(defaultSheet, r.sheet); err != nil {
+				return err
+			}
+			first = false
+		} else if _, err := f.NewSheet(r.sheet); err != nil {
+			return err
+		}
+
+		header := make([]interface{}, len(r.headers))
+		for i, h := range r.headers {
+			header[i] = h
+		}
+		if err := f.SetSheetRow(r.sheet, "A1", &header); err != nil {
+			return err
+		}
+		for i, row := range r.rows {
+			cell, _ := excelize.CoordinatesToCellName(1, i+2)
+			values := row
+			if err := f.SetSheetRow(r.sheet, cell, &values); err != nil {
+				return err
+			}
+		}
+	}
+
+	return f.SaveAs(path)
+}
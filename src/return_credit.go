@@ -0,0 +1,149 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// How invoice-return books the value of an imported return.
+const (
+	ReturnCreditNone    = "none"    // leave it to manual work
+	ReturnCreditInvoice = "invoice" // deduct from the referenced invoice, rest as deposit
+	ReturnCreditDeposit = "deposit" // book it all as outlet deposit
+)
+
+// returnDepositExists reports whether the return already has a deposit,
+// either linked by return_invoice_id or imported by `deposit` under the
+// return number before the return itself existed.
+func returnDepositExists(tx *sql.Tx, returnInvoiceID int64, returnNumber string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`
+		SELECT COUNT(*)
+		FROM list_outlet_deposit
+		WHERE return_invoice_id = ? OR (return_invoice_id IS NULL AND deposit_number = ? AND debit > 0)
+	`, returnInvoiceID, returnNumber).Scan(&count)
+	return count > 0, err
+}
+
+// insertReturnDeposit books the value of a return as outlet deposit (debit).
+func insertReturnDeposit(tx *sql.Tx, c *ReturnCreditData, note string, adminID int) error {
+	_, err := tx.Exec(`
+		INSERT INTO list_outlet_deposit (
+			deposit_date, deposit_number, deposit_type_id, outlet_id,
+			branch_id, deposit_location_id, debit, credit,
+			note, settlement_id, sales_invoice_id, return_invoice_id,
+			createdAt, createdBy
+		) VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, NULL, NULL, ?, ?, ?)
+	`, c.depositDate(), c.ReturnNumber, DepositTypeRetur, c.OutletID, c.BranchID, c.BranchID, c.Amount,
+		note, c.ReturnInvoiceID, time.Now().Format("2006-01-02 15:04:05"), adminID)
+	return err
+}
+
+// postReturnCredits books the returns imported in this run. In invoice mode
+// the return is booked as deposit and used right away against the
+// referenced invoice (a credit without settlement, which invoicePaidAmount
+// counts); whatever exceeds the outstanding stays on the outlet deposit.
+func postReturnCredits(tx *sql.Tx, credits []ReturnCreditPosting, mode string, tolerance Money, adminID int, report *importReport) error {
+	outstanding := newOutstandingTracker(tx)
+	for i := range credits {
+		p := &credits[i]
+		c := &p.Credit
+		err := tx.QueryRow("SELECT return_invoice_id FROM list_invoice_return WHERE return_number = ? LIMIT 1", c.ReturnNumber).Scan(&c.ReturnInvoiceID)
+		if err != nil {
+			return fmt.Errorf("return %s: %v", c.ReturnNumber, err)
+		}
+		if c.Amount <= tolerance {
+			report.add(p.Row, c.ReturnNumber, p.InvoiceNumber, c.Amount, 0, 0, "nilai retur kosong, tidak diposting")
+			continue
+		}
+
+		exists, err := returnDepositExists(tx, c.ReturnInvoiceID, c.ReturnNumber)
+		if err != nil {
+			return err
+		}
+		if exists {
+			report.add(p.Row, c.ReturnNumber, p.InvoiceNumber, c.Amount, 0, 0, "sudah ada deposit untuk retur ini (import deposit), tidak diposting")
+			continue
+		}
+
+		if mode == ReturnCreditDeposit {
+			if err := insertReturnDeposit(tx, c, "DEPOSIT INVOICE RETUR", adminID); err != nil {
+				return err
+			}
+			report.add(p.Row, c.ReturnNumber, nil, c.Amount, 0, c.Amount, "diposting sebagai deposit")
+			continue
+		}
+
+		if p.InvoiceNumber == "" {
+			report.add(p.Row, c.ReturnNumber, nil, c.Amount, 0, 0, "nomor faktur kosong, tidak diposting")
+			continue
+		}
+		var inv DepositRefData
+		var invoiceAmount Money
+		err = tx.QueryRow(`
+			SELECT sales_invoice_id, outlet_id, branch_id, amount
+			FROM list_sales_invoice
+			WHERE sales_invoice_number = ?
+			LIMIT 1
+		`, p.InvoiceNumber).Scan(&inv.ID, &inv.OutletID, &inv.BranchID, &invoiceAmount)
+		if err == sql.ErrNoRows {
+			report.add(p.Row, c.ReturnNumber, p.InvoiceNumber, c.Amount, 0, 0, "faktur tidak ditemukan, tidak diposting")
+			continue
+		} else if err != nil {
+			return err
+		}
+		if msg := inv.mismatch(c.OutletID, c.BranchID); msg != "" {
+			report.add(p.Row, c.ReturnNumber, p.InvoiceNumber, c.Amount, 0, 0, "faktur "+msg+", tidak diposting")
+			continue
+		}
+
+		left, err := outstanding.remaining(inv.ID, p.InvoiceNumber, invoiceAmount)
+		if err != nil {
+			return err
+		}
+		applied := maxMoney(0, minMoney(left, c.Amount))
+		if err := insertReturnDeposit(tx, c, "KREDIT NOTA RETUR", adminID); err != nil {
+			return err
+		}
+		if applied > tolerance {
+			_, err = tx.Exec(`
+				INSERT INTO list_outlet_deposit (
+					deposit_date, deposit_number, deposit_type_id, outlet_id,
+					branch_id, deposit_location_id, debit, credit,
+					note, settlement_id, sales_invoice_id, return_invoice_id,
+					createdAt, createdBy
+				) VALUES (?, ?, ?, ?, ?, ?, 0, ?, ?, NULL, ?, ?, ?, ?)
+			`, c.depositDate(), c.ReturnNumber, DepositTypeRetur, c.OutletID, c.BranchID, c.BranchID, applied,
+				"POTONG FAKTUR RETUR", inv.ID, c.ReturnInvoiceID, time.Now().Format("2006-01-02 15:04:05"), adminID)
+			if err != nil {
+				return err
+			}
+			outstanding.apply(inv.ID, applied)
+		} else {
+			applied = 0
+		}
+
+		note := "dipotong dari faktur"
+		if c.Amount-applied > tolerance {
+			note = "dipotong dari faktur, sisa menjadi deposit"
+		}
+		report.add(p.Row, c.ReturnNumber, p.InvoiceNumber, c.Amount, applied, c.Amount-applied, note)
+	}
+	return nil
+}
+
+// depositDate dates the deposit rows of a return on the return date.
+func (c *ReturnCreditData) depositDate() interface{} {
+	if c.ReturnDate != "" {
+		return c.ReturnDate
+	}
+	return time.Now().Format("2006-01-02")
+}
+
+// Helper struct
+type ReturnCreditPosting struct {
+	Row           int
+	InvoiceNumber string
+	Credit        ReturnCreditData
+}
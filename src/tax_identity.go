@@ -0,0 +1,148 @@
+package src
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Province codes that can start a NIK (first two digits).
+var nikProvinceCodes = map[string]bool{
+	"11": true, "12": true, "13": true, "14": true, "15": true, "16": true, "17": true, "18": true, "19": true,
+	"21": true, "31": true, "32": true, "33": true, "34": true, "35": true, "36": true,
+	"51": true, "52": true, "53": true, "61": true, "62": true, "63": true, "64": true, "65": true,
+	"71": true, "72": true, "73": true, "74": true, "75": true, "76": true, "81": true, "82": true,
+	"91": true, "92": true, "93": true, "94": true, "95": true, "96": true, "97": true,
+}
+
+// digitsOnly drops the usual NPWP formatting ("01.234.567.8-901.000").
+// It returns false when anything other than digits and separators is left.
+func digitsOnly(raw string) (string, bool) {
+	b := strings.Builder{}
+	for _, r := range strings.TrimSpace(raw) {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '.' || r == '-' || r == ' ':
+		default:
+			return "", false
+		}
+	}
+	return b.String(), true
+}
+
+// normalizeNPWP returns the NPWP as bare digits. Both the old 15 digit and
+// the 16 digit (NIK based / Coretax) forms are accepted.
+func normalizeNPWP(raw string) (string, error) {
+	npwp, ok := digitsOnly(raw)
+	if !ok {
+		return "", fmt.Errorf("NPWP mengandung karakter tidak valid")
+	}
+	if len(npwp) != 15 && len(npwp) != 16 {
+		return "", fmt.Errorf("NPWP harus 15 atau 16 digit (%d digit)", len(npwp))
+	}
+	if strings.Trim(npwp, "0") == "" {
+		return "", fmt.Errorf("NPWP tidak boleh nol semua")
+	}
+	return npwp, nil
+}
+
+// npwp16 converts a 15 digit NPWP to its 16 digit form.
+func npwp16(npwp string) string {
+	if len(npwp) == 15 {
+		return "0" + npwp
+	}
+	return npwp
+}
+
+// validateNIK checks the 16 digit NIK layout: province code, birth date
+// (DDMMYY, day + 40 for women) and a non-zero sequence number.
+func validateNIK(raw string) (string, error) {
+	nik, ok := digitsOnly(raw)
+	if !ok || len(nik) != 16 {
+		return "", fmt.Errorf("NIK harus 16 digit")
+	}
+	if !nikProvinceCodes[nik[:2]] {
+		return "", fmt.Errorf("kode provinsi NIK tidak dikenal (%s)", nik[:2])
+	}
+	day, _ := strconv.Atoi(nik[6:8])
+	month, _ := strconv.Atoi(nik[8:10])
+	if day > 40 {
+		day -= 40
+	}
+	// 2000 is a leap year so 29 February stays valid
+	d := time.Date(2000, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if month < 1 || month > 12 || day < 1 || d.Day() != day {
+		return "", fmt.Errorf("tanggal lahir pada NIK tidak valid (%s)", nik[6:12])
+	}
+	if nik[12:] == "0000" {
+		return "", fmt.Errorf("nomor urut NIK tidak valid")
+	}
+	return nik, nil
+}
+
+// validateNITKU checks a 22 digit NITKU whose first 16 digits must be the
+// (16 digit) NPWP it belongs to.
+func validateNITKU(raw, npwp string) (string, error) {
+	nitku, ok := digitsOnly(raw)
+	if !ok || len(nitku) != 22 {
+		return "", fmt.Errorf("NITKU harus 22 digit")
+	}
+	if npwp != "" && nitku[:16] != npwp16(npwp) {
+		return "", fmt.Errorf("NITKU tidak sesuai dengan NPWP")
+	}
+	return nitku, nil
+}
+
+// TaxIdentity holds the normalised outlet tax identifiers. Invalid values are
+// kept as typed so nothing is lost when the row is imported anyway.
+type TaxIdentity struct {
+	NPWP       string
+	NIK        string
+	NITKU      string
+	ValidNPWP  bool
+	Violations []string
+}
+
+// checkTaxIdentity validates the NPWP, NIK and NITKU of an outlet. isPkp
+// outlets must have a valid NPWP.
+func checkTaxIdentity(npwpRaw, nikRaw, nitkuRaw string, isPkp bool) TaxIdentity {
+	t := TaxIdentity{NPWP: npwpRaw, NIK: nikRaw, NITKU: nitkuRaw}
+
+	if npwpRaw != "" {
+		if npwp, err := normalizeNPWP(npwpRaw); err != nil {
+			t.Violations = append(t.Violations, err.Error())
+		} else {
+			t.NPWP = npwp
+			t.ValidNPWP = true
+		}
+	} else if isPkp {
+		t.Violations = append(t.Violations, "outlet PKP wajib memiliki NPWP")
+	}
+	if isPkp && npwpRaw != "" && !t.ValidNPWP {
+		t.Violations = append(t.Violations, "outlet PKP tidak memiliki NPWP yang valid")
+	}
+
+	if nikRaw != "" {
+		if nik, err := validateNIK(nikRaw); err != nil {
+			t.Violations = append(t.Violations, err.Error())
+		} else {
+			t.NIK = nik
+		}
+	}
+
+	if nitkuRaw != "" {
+		npwp := ""
+		if t.ValidNPWP {
+			npwp = t.NPWP
+		}
+		if nitku, err := validateNITKU(nitkuRaw, npwp); err != nil {
+			t.Violations = append(t.Violations, err.Error())
+		} else {
+			t.NITKU = nitku
+		}
+	}
+
+	return t
+}
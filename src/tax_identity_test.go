@@ -0,0 +1,128 @@
+package src
+
+import "testing"
+
+func TestNormalizeNPWP(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{"formatted 15 digit", "01.234.567.8-901.000", "012345678901000", false},
+		{"bare 16 digit", "3171234567890001", "3171234567890001", false},
+		{"spaces", " 01 234 567 8 901 000 ", "012345678901000", false},
+		{"too short", "01.234.567.8-901", "", true},
+		{"too long", "01234567890123456", "", true},
+		{"letters", "01.234.567.8-9O1.000", "", true},
+		{"all zero", "000000000000000", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeNPWP(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeNPWP(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeNPWP(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNPWP16(t *testing.T) {
+	if got := npwp16("012345678901000"); got != "0012345678901000" {
+		t.Errorf("npwp16 15 digit = %q", got)
+	}
+	if got := npwp16("3171234567890001"); got != "3171234567890001" {
+		t.Errorf("npwp16 16 digit = %q", got)
+	}
+}
+
+func TestValidateNIK(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{"valid", "3171011501900001", false},
+		{"female birth day", "3171015501900001", false},
+		{"29 february", "3171012902000001", false},
+		{"formatted", "3171-0115-0190-0001", false},
+		{"15 digit", "317101150190001", true},
+		{"unknown province", "0171011501900001", true},
+		{"month 13", "3171011513900001", true},
+		{"31 april", "3171013104900001", true},
+		{"zero sequence", "3171011501900000", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateNIK(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNIK(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNITKU(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		npwp    string
+		wantErr bool
+	}{
+		{"matches 16 digit npwp", "3171234567890001000000", "3171234567890001", false},
+		{"matches 15 digit npwp", "0012345678901000000000", "012345678901000", false},
+		{"no npwp to compare", "3171234567890001000000", "", false},
+		{"other npwp", "3171234567890002000000", "3171234567890001", true},
+		{"21 digit", "317123456789000100000", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateNITKU(tt.raw, tt.npwp)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateNITKU(%q, %q) error = %v, wantErr %v", tt.raw, tt.npwp, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckTaxIdentity(t *testing.T) {
+	tests := []struct {
+		name       string
+		npwp       string
+		nik        string
+		isPkp      bool
+		validNPWP  bool
+		violations int
+	}{
+		{"valid pkp", "01.234.567.8-901.000", "", true, true, 0},
+		{"pkp without npwp", "", "", true, false, 1},
+		{"invalid npwp non pkp", "12345", "", false, false, 1},
+		{"invalid npwp pkp", "12345", "", true, false, 2},
+		{"invalid nik", "", "123", false, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkTaxIdentity(tt.npwp, tt.nik, "", tt.isPkp)
+			if got.ValidNPWP != tt.validNPWP || len(got.Violations) != tt.violations {
+				t.Errorf("checkTaxIdentity(%q, %q, pkp=%v) = valid %v, violations %v", tt.npwp, tt.nik, tt.isPkp, got.ValidNPWP, got.Violations)
+			}
+			// invalid values are kept as typed
+			if !got.ValidNPWP && got.NPWP != tt.npwp {
+				t.Errorf("invalid NPWP not kept: %q", got.NPWP)
+			}
+		})
+	}
+}
+
+func TestOutletTaxDocumentType(t *testing.T) {
+	// an invalid NPWP is still an NPWP document; the number is reported instead
+	if got := outletTaxDocumentType("12345"); got != "Dokumen dengan NPWP/NIK tervalidasi" {
+		t.Errorf("document type with npwp = %q", got)
+	}
+	if got := outletTaxDocumentType(""); got != "Dokumen dengan NIK" {
+		t.Errorf("document type without npwp = %q", got)
+	}
+}
@@ -0,0 +1,232 @@
+package src
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// PKP scope of a tax rule
+const (
+	TaxScopeAll    = ""
+	TaxScopePKP    = "pkp"
+	TaxScopeNonPKP = "non-pkp"
+)
+
+// defaultTaxRules is the PPN history used when no --tax-rules file is given.
+// From 2025 the 12% rate is charged on DPP nilai lain (11/12 of the selling
+// price) for regular goods, so the effective tax stays at 11%.
+var defaultTaxRules = []TaxRule{
+	{EffectiveFrom: "0001-01-01", Rate: 10 * percentScale, DPPFactor: ratioOne},
+	{EffectiveFrom: "2022-04-01", Rate: 11 * percentScale, DPPFactor: ratioOne},
+	{EffectiveFrom: "2025-01-01", Rate: 12 * percentScale, DPPFactor: Ratio{Num: 11, Den: 12}},
+}
+
+// taxRuleSet picks the PPN rule in force on a date.
+type taxRuleSet struct {
+	rules []TaxRule
+}
+
+func newTaxRuleSet(rules []TaxRule) *taxRuleSet {
+	s := &taxRuleSet{rules: append([]TaxRule{}, rules...)}
+	sort.SliceStable(s.rules, func(i, j int) bool { return s.rules[i].EffectiveFrom < s.rules[j].EffectiveFrom })
+	return s
+}
+
+// loadTaxRules reads the rule table (0 effective date, 1 rate %, 2 DPP
+// factor, 3 pkp|non-pkp, empty for all) from the first sheet of an xlsx
+// file. An empty path gives the built-in rules.
+func loadTaxRules(path string) (*taxRuleSet, error) {
+	if path == "" {
+		return newTaxRuleSet(defaultTaxRules), nil
+	}
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rows, err := f.GetRows(f.GetSheetName(0))
+	if err != nil {
+		return nil, err
+	}
+
+	rules := []TaxRule{}
+	for r := 1; r < len(rows); r++ { // skip header
+		rowData := rows[r]
+		getCol := func(idx int) *string {
+			if idx < len(rowData) {
+				return checkIsTrueEmpty(rowData[idx])
+			}
+			return nil
+		}
+		if getCol(0) == nil {
+			continue
+		}
+		date, ok := parseDateStrict(getCol(0))
+		if !ok || date == nil {
+			return nil, fmt.Errorf("baris %d: tanggal berlaku tidak valid", r+1)
+		}
+		rate, err := parseTaxRate(getCol(1))
+		if err != nil {
+			return nil, fmt.Errorf("baris %d: %v", r+1, err)
+		}
+		rule := TaxRule{EffectiveFrom: date.(string), Rate: rate, DPPFactor: ratioOne}
+		if p := getCol(2); p != nil {
+			factor, err := parseTaxFactor(*p)
+			if err != nil {
+				return nil, fmt.Errorf("baris %d: %v", r+1, err)
+			}
+			rule.DPPFactor = factor
+		}
+		switch scope := strings.ToLower(getString(getCol(3))); scope {
+		case TaxScopeAll, TaxScopePKP, TaxScopeNonPKP:
+			rule.PKP = scope
+		default:
+			return nil, fmt.Errorf("baris %d: status pkp tidak dikenal: %s", r+1, scope)
+		}
+		rules = append(rules, rule)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("tabel pajak kosong")
+	}
+	return newTaxRuleSet(rules), nil
+}
+
+// resolve returns the latest rule effective on date for the outlet's PKP
+// status. At the same date a rule for the specific status wins over one for
+// all outlets.
+func (s *taxRuleSet) resolve(date string, pkp bool) TaxRule {
+	scope := TaxScopeNonPKP
+	if pkp {
+		scope = TaxScopePKP
+	}
+	found := TaxRule{Rate: 0, DPPFactor: ratioOne}
+	for _, rule := range s.rules {
+		if rule.EffectiveFrom > date {
+			break
+		}
+		if rule.PKP != TaxScopeAll && rule.PKP != scope {
+			continue
+		}
+		if rule.EffectiveFrom == found.EffectiveFrom && found.PKP != TaxScopeAll && rule.PKP == TaxScopeAll {
+			continue
+		}
+		found = rule
+	}
+	return found
+}
+
+// withRate applies the PPN rate of an invoice to the rule in force on its
+// date. The rule's rate keeps the rule's DPP factor; any other rate is an
+// override charged on the full price. Only the rate is stored with the
+// invoice, so the rule's own rate cannot be overridden onto the full price.
+func (r TaxRule) withRate(rate Percent) TaxRule {
+	if rate != r.Rate {
+		r.Rate, r.DPPFactor = rate, ratioOne
+	}
+	return r
+}
+
+// fromPPNCell applies the ppn cell of an invoice row to the rule. The legacy
+// export writes the PPN amount included in total (the invoice total after
+// cash discount); an amount within one rupiah of the rule's keeps the rule,
+// zero means no PPN and any other amount is charged on the full price at
+// the rate it implies. A cell with "%" or "/" is an explicit rate.
+func (r TaxRule) fromPPNCell(v string, total Money) (TaxRule, error) {
+	s := strings.TrimSpace(v)
+	if strings.ContainsAny(s, "%/") {
+		rate, err := parseTaxRate(&s)
+		if err != nil {
+			return TaxRule{}, err
+		}
+		return r.withRate(rate), nil
+	}
+	amount, err := parseMoney(denormalizeNumber(&s))
+	if err != nil || amount < 0 {
+		return TaxRule{}, fmt.Errorf("ppn tidak valid: %s", v)
+	}
+	if amount == 0 {
+		return r.withRate(0), nil
+	}
+	base := total - amount
+	if base <= 0 {
+		return TaxRule{}, fmt.Errorf("ppn %s tidak lebih kecil dari total %s", amount, total)
+	}
+	if (base.mulRatio(r.DPPFactor).percent(r.Rate) - amount).abs() <= moneyScale {
+		return r, nil
+	}
+	rate := Percent(mulDivRound(int64(amount), 100*percentScale, int64(base)))
+	return r.withRate(rate), nil
+}
+
+// forInvoice returns the rule of a stored invoice from its date, the
+// outlet's PKP status and the stored PPN rate, the same way the header
+// import derived it, so no DPP factor needs to be stored with the invoice.
+func (s *taxRuleSet) forInvoice(date string, pkp bool, storedRate Percent) TaxRule {
+	return s.resolve(date, pkp).withRate(storedRate)
+}
+
+// parseTaxRate reads a PPN rate cell such as "11", "11%", "0,5%" or
+// "12/100". A bare number is a percentage; a bare number between 0 and 1
+// is ambiguous ("0.12" could be 12% or 0.12%) and is rejected.
+func parseTaxRate(v *string) (Percent, error) {
+	if v == nil {
+		return 0, fmt.Errorf("tarif ppn kosong")
+	}
+	s := strings.TrimSpace(*v)
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, err1 := parseDecimal(strings.ReplaceAll(strings.TrimSpace(num), ",", "."), 4)
+		d, err2 := parseDecimal(strings.ReplaceAll(strings.TrimSpace(den), ",", "."), 4)
+		if err1 != nil || err2 != nil || n < 0 || d <= 0 || n > d {
+			return 0, fmt.Errorf("tarif ppn tidak valid: %s", *v)
+		}
+		return Percent(quoRound(big.NewInt(n*100*percentScale), big.NewInt(d))), nil
+	}
+	explicit := strings.HasSuffix(s, "%")
+	s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+	n, err := parseDecimal(strings.ReplaceAll(s, ",", "."), 4)
+	rate := Percent(n)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("tarif ppn tidak valid: %s", *v)
+	}
+	if !explicit && rate > 0 && rate < percentScale {
+		return 0, fmt.Errorf("tarif ppn ambigu: %s, tulis sebagai persen (12%%) atau pecahan (12/100)", *v)
+	}
+	if rate > 100*percentScale {
+		return 0, fmt.Errorf("tarif ppn tidak valid: %s", *v)
+	}
+	return rate, nil
+}
+
+// parseTaxFactor reads a DPP factor written as a fraction ("11/12") or a
+// decimal ("0.9167", kept to four decimals).
+func parseTaxFactor(v string) (Ratio, error) {
+	if num, den, ok := strings.Cut(v, "/"); ok {
+		n, err1 := strconv.ParseInt(strings.TrimSpace(num), 10, 64)
+		d, err2 := strconv.ParseInt(strings.TrimSpace(den), 10, 64)
+		if err1 != nil || err2 != nil || n <= 0 || d <= 0 || n > d {
+			return Ratio{}, fmt.Errorf("faktor dpp tidak valid: %s", v)
+		}
+		return Ratio{Num: n, Den: d}, nil
+	}
+	n, err := parseDecimal(strings.ReplaceAll(strings.TrimSpace(v), ",", "."), 4)
+	if err != nil || n <= 0 || n > percentScale {
+		return Ratio{}, fmt.Errorf("faktor dpp tidak valid: %s", v)
+	}
+	if n == percentScale {
+		return ratioOne, nil
+	}
+	return Ratio{Num: n, Den: percentScale}, nil
+}
+
+// Helper struct
+type TaxRule struct {
+	EffectiveFrom string  // YYYY-MM-DD
+	Rate          Percent // PPN %
+	DPPFactor     Ratio   // share of the selling price taxed (DPP nilai lain)
+	PKP           string  // TaxScopeAll, TaxScopePKP or TaxScopeNonPKP
+}
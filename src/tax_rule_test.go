@@ -0,0 +1,90 @@
+package src
+
+import "testing"
+
+func TestParseTaxRate(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    Percent
+		wantErr bool
+	}{
+		{"11", 11 * percentScale, false},
+		{"12%", 12 * percentScale, false},
+		{"0,5%", percentScale / 2, false},
+		{"0.5%", percentScale / 2, false},
+		{"12/100", 12 * percentScale, false},
+		{"0", 0, false},
+		{"0.5", 0, true},
+		{"0,12", 0, true},
+		{"101", 0, true},
+		{"-1", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		raw := tt.raw
+		got, err := parseTaxRate(&raw)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("parseTaxRate(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("parseTaxRate(%q) = %d, want %d", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestTaxRuleForInvoice(t *testing.T) {
+	rules := newTaxRuleSet(defaultTaxRules)
+	tests := []struct {
+		name string
+		date string
+		rate Percent
+		want Ratio
+	}{
+		{"rule rate keeps the rule factor", "2025-03-01", 12 * percentScale, Ratio{Num: 11, Den: 12}},
+		{"overridden rate on full price", "2025-03-01", 11 * percentScale, ratioOne},
+		{"rule without factor", "2024-06-01", 11 * percentScale, ratioOne},
+		{"no ppn", "2025-03-01", 0, ratioOne},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rules.forInvoice(tt.date, true, tt.rate)
+			if got.DPPFactor != tt.want || got.Rate != tt.rate {
+				t.Errorf("forInvoice = %+v, want factor %v rate %d", got, tt.want, tt.rate)
+			}
+		})
+	}
+}
+
+func TestTaxRuleFromPPNCell(t *testing.T) {
+	rules := newTaxRuleSet(defaultTaxRules)
+	tests := []struct {
+		name    string
+		date    string
+		cell    string
+		total   Money
+		rate    Percent
+		factor  Ratio
+		wantErr bool
+	}{
+		{"amount of the 2025 rule", "2025-08-01", "423225", 4270725 * moneyScale, 12 * percentScale, Ratio{Num: 11, Den: 12}, false},
+		{"amount of the 2021 rule", "2021-05-01", "177742", 1955163 * moneyScale, 10 * percentScale, ratioOne, false},
+		{"amount within a rupiah", "2024-06-01", "1,001", 10100 * moneyScale, 11 * percentScale, ratioOne, false},
+		{"no ppn", "2025-08-01", "0", 1000000 * moneyScale, 0, ratioOne, false},
+		{"other amount on full price", "2025-08-01", "50000", 1050000 * moneyScale, 5 * percentScale, ratioOne, false},
+		{"explicit rule rate", "2025-08-01", "12%", 1120000 * moneyScale, 12 * percentScale, Ratio{Num: 11, Den: 12}, false},
+		{"explicit other rate", "2025-08-01", "11/100", 1110000 * moneyScale, 11 * percentScale, ratioOne, false},
+		{"amount not below total", "2025-08-01", "100", 100 * moneyScale, 0, Ratio{}, true},
+		{"text", "2025-08-01", "ex: angka", 100 * moneyScale, 0, Ratio{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := rules.resolve(tt.date, true).fromPPNCell(tt.cell, tt.total)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("fromPPNCell error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (got.Rate != tt.rate || got.DPPFactor != tt.factor) {
+				t.Errorf("fromPPNCell = %+v, want rate %d factor %v", got, tt.rate, tt.factor)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package src
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Import modes for master data importers
+const (
+	ImportModeInsert = "insert" // only new rows, existing keys are reported as duplicates
+	ImportModeUpdate = "update" // only existing rows, unknown keys are reported
+	ImportModeUpsert = "upsert"
+)
+
+func validImportMode(mode string) bool {
+	return mode == ImportModeInsert || mode == ImportModeUpdate || mode == ImportModeUpsert
+}
+
+// columnChange is one changed column of an updated row.
+type columnChange struct {
+	Column string
+	Old    string
+	New    string
+	Value  interface{} // value bound on update
+}
+
+// formatDBValue renders a value the way it is compared and reported.
+func formatDBValue(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(t)
+	case string:
+		return t
+	case sql.NullInt64:
+		if !t.Valid {
+			return ""
+		}
+		return strconv.FormatInt(t.Int64, 10)
+	case sql.NullString:
+		if !t.Valid {
+			return ""
+		}
+		return t.String
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// sameDBValue compares two rendered values, treating "10", "10.00" and
+// "1e1" as equal so decimal columns do not show up as changed.
+func sameDBValue(a, b string) bool {
+	if a == b {
+		return true
+	}
+	fa, errA := strconv.ParseFloat(strings.TrimSpace(a), 64)
+	fb, errB := strconv.ParseFloat(strings.TrimSpace(b), 64)
+	if errA == nil && errB == nil {
+		return math.Abs(fa-fb) < 1e-9
+	}
+	return false
+}
+
+// fetchRowValues loads cols of the row where keyCol = keyVal, rendered as
+// strings. A missing row returns a nil map.
+func fetchRowValues(tx *sql.Tx, table, keyCol string, keyVal interface{}, cols []string) (map[string]string, error) {
+	q := fmt.Sprintf("SELECT `%s` FROM `%s` WHERE `%s` = ? LIMIT 1", strings.Join(cols, "`, `"), table, keyCol)
+	vals := make([]sql.RawBytes, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	rows, err := tx.Query(q, keyVal)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, err
+	}
+	current := make(map[string]string, len(cols))
+	for i, c := range cols {
+		current[c] = string(vals[i])
+	}
+	return current, nil
+}
+
+// diffRowValues returns the columns (in cols order) whose incoming value
+// differs from current. Columns marked blank came from an empty cell and are
+// left untouched unless blankClears is set; then they are set to NULL rather
+// than to whatever default the row parser filled in.
+func diffRowValues(current map[string]string, incoming map[string]interface{}, cols []string, blank map[string]bool, blankClears bool) []columnChange {
+	changes := []columnChange{}
+	for _, c := range cols {
+		v, ok := incoming[c]
+		if !ok {
+			continue
+		}
+		if blank[c] {
+			if !blankClears {
+				continue
+			}
+			v = nil
+		}
+		newVal := formatDBValue(v)
+		if sameDBValue(current[c], newVal) {
+			continue
+		}
+		changes = append(changes, columnChange{Column: c, Old: current[c], New: newVal, Value: v})
+	}
+	return changes
+}
+
+// applyRowUpdate writes the changed columns of one row.
+func applyRowUpdate(tx *sql.Tx, table, keyCol string, keyVal interface{}, changes []columnChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	sets := make([]string, 0, len(changes))
+	args := make([]interface{}, 0, len(changes)+1)
+	for _, ch := range changes {
+		sets = append(sets, fmt.Sprintf("`%s` = ?", ch.Column))
+		args = append(args, ch.Value)
+	}
+	args = append(args, keyVal)
+	q := fmt.Sprintf("UPDATE `%s` SET %s WHERE `%s` = ?", table, strings.Join(sets, ", "), keyCol)
+	_, err := tx.Exec(q, args...)
+	return err
+}